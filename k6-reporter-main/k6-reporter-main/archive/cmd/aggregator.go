@@ -0,0 +1,490 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Inputs holding raw samples (rather than the end-of-test summary) are aggregated here, computing
+// the same stats K6 puts in its summary, so they can be rendered in exactly the same way
+
+// Default trend stats, same as K6's own summaryTrendStats default
+const defaultTrendStats = "avg,min,med,max,p(90),p(95)"
+
+// sample is a single metric data point
+type sample struct {
+	Metric string
+	Time   time.Time
+	Value  float64
+	Tags   map[string]string
+}
+
+// metricDefinition declares a metric, its thresholds and any submetrics
+type metricDefinition struct {
+	Name       string
+	Type       string
+	Contains   string
+	Thresholds []thresholdConfig
+	Submetrics []submetricDefinition
+}
+
+// thresholdConfig is a threshold as set in the script options, e.g. {threshold: "p(95)<500", abortOnFail: true}
+type thresholdConfig struct {
+	Source      string
+	AbortOnFail bool
+}
+
+// submetricDefinition is a metric filtered by tags, e.g. http_req_duration{expected_response:true}
+type submetricDefinition struct {
+	Name string
+	Tags map[string]string
+}
+
+// metricSink accumulates the samples of a single metric or submetric
+type metricSink struct {
+	name       string
+	kind       metricKind
+	thresholds []*thresholdExpression
+	configs    []thresholdConfig
+	tags       map[string]string // Only set for submetrics, the tags a sample must have
+
+	values  []float64 // Only kept for trends
+	sorted  bool
+	count   int
+	nonZero int
+	sum     float64
+	min     float64
+	max     float64
+	last    float64
+}
+
+// groupNode is a group as it's discovered in the samples, turned into a Group tree at the end
+type groupNode struct {
+	name       string
+	path       string
+	children   []string
+	checks     map[string]*Check
+	checkOrder []string
+}
+
+// aggregator computes metric stats, groups and checks from raw samples
+type aggregator struct {
+	trendStats []string
+	sinks      map[string]*metricSink
+	submetrics map[string][]*metricSink // Keyed by parent metric name
+	groups     map[string]*groupNode    // Keyed by group path
+	timeline   *timelineRecorder
+	endpoints  *endpointRecorder
+	responses  *responseRecorder
+	scenarios  *scenarioRecorder
+	scores     *scoreRecorder
+	drift      *driftRecorder
+	bucket     time.Duration // Timeline bucket size, 0 to pick one from the length of the test
+	limits     capacityLimits
+	first      time.Time
+	last       time.Time
+}
+
+func newAggregator(trendStats []string) *aggregator {
+	agg := &aggregator{
+		trendStats: trendStats,
+		sinks:      map[string]*metricSink{},
+		submetrics: map[string][]*metricSink{},
+		groups:     map[string]*groupNode{"": {checks: map[string]*Check{}}},
+		timeline:   newTimelineRecorder(),
+		endpoints:  newEndpointRecorder(nil),
+		responses:  newResponseRecorder(),
+		scenarios:  newScenarioRecorder(nil),
+	}
+	agg.scores = newScoreRecorder(agg.endpoints)
+	agg.drift = newDriftRecorder(agg.endpoints)
+	return agg
+}
+
+// parseTrendStats validates a comma separated list of trend stats, e.g. "avg,p(95),p(99.9)"
+func parseTrendStats(list string) ([]string, error) {
+	stats := []string{}
+	for _, stat := range strings.Split(list, ",") {
+		stat = strings.TrimSpace(stat)
+		if stat == "" {
+			continue
+		}
+		switch stat {
+		case "avg", "min", "med", "max", "count":
+		default:
+			method, pct, err := parseThresholdAggregationMethod(stat)
+			if err != nil || method != "p" {
+				return nil, fmt.Errorf("invalid trend stat %q", stat)
+			}
+			stat = percentileStat(pct)
+		}
+		stats = append(stats, stat)
+	}
+	return stats, nil
+}
+
+// addDefinition declares a metric, any threshold expressions which won't parse are an error
+func (a *aggregator) addDefinition(def metricDefinition) error {
+	kind := metricKind{def.Type, def.Contains}
+	if kind.Contains == "" {
+		kind.Contains = "default"
+	}
+	sink, err := a.sink(def.Name, kind, nil)
+	if err != nil {
+		return err
+	}
+	if err := sink.addThresholds(def.Thresholds); err != nil {
+		return err
+	}
+	// Submetrics added before their metric was declared take on its type
+	for _, subSink := range a.submetrics[def.Name] {
+		subSink.kind = kind
+	}
+
+	for _, sub := range def.Submetrics {
+		tags := sub.Tags
+		if tags == nil {
+			tags = parseSubmetricTags(sub.Name)
+		}
+		subSink, err := a.sink(sub.Name, kind, tags)
+		if err != nil {
+			return err
+		}
+		if !containsSink(a.submetrics[def.Name], subSink) {
+			a.submetrics[def.Name] = append(a.submetrics[def.Name], subSink)
+		}
+	}
+
+	return nil
+}
+
+// addSubmetric computes a submetric that isn't declared in the results, e.g. http_req_duration{group:::kasir}
+func (a *aggregator) addSubmetric(name string) error {
+	parent := baseMetricName(name)
+	if parent == name {
+		return fmt.Errorf("submetric %q has no tags, expected e.g. %s{status:200}", name, name)
+	}
+
+	kind := metricKind{}
+	if parentSink, ok := a.sinks[parent]; ok {
+		kind = parentSink.kind
+	}
+	subSink, err := a.sink(name, kind, parseSubmetricTags(name))
+	if err != nil {
+		return err
+	}
+	if !containsSink(a.submetrics[parent], subSink) {
+		a.submetrics[parent] = append(a.submetrics[parent], subSink)
+	}
+	return nil
+}
+
+// sink finds or creates the sink for a metric, metrics not declared are assumed to be built-in or trends
+func (a *aggregator) sink(name string, kind metricKind, tags map[string]string) (*metricSink, error) {
+	if sink, ok := a.sinks[name]; ok {
+		if kind.Type != "" {
+			sink.kind = kind
+		}
+		return sink, nil
+	}
+
+	if kind.Type == "" {
+		var ok bool
+		if kind, ok = builtinMetrics[baseMetricName(name)]; !ok {
+			kind = metricKind{"trend", "default"}
+		}
+	}
+	switch kind.Type {
+	case "counter", "gauge", "rate", "trend":
+	default:
+		return nil, fmt.Errorf("metric %q has unknown type %q", name, kind.Type)
+	}
+
+	sink := &metricSink{name: name, kind: kind, tags: tags}
+	a.sinks[name] = sink
+	return sink, nil
+}
+
+// addSample adds a sample to its metric, any matching submetrics, and its group & check
+func (a *aggregator) addSample(s sample) error {
+	if a.first.IsZero() || s.Time.Before(a.first) {
+		a.first = s.Time
+	}
+	if s.Time.After(a.last) {
+		a.last = s.Time
+	}
+
+	sink, err := a.sink(s.Metric, metricKind{}, nil)
+	if err != nil {
+		return err
+	}
+	sink.add(s.Value)
+	a.timeline.add(s)
+	a.endpoints.add(s)
+	a.responses.add(s)
+	a.scenarios.add(s, sink.kind)
+	a.scores.add(s)
+	a.drift.add(s)
+	for _, sub := range a.submetrics[s.Metric] {
+		if sub.matches(s.Tags) {
+			sub.add(s.Value)
+		}
+	}
+
+	group := a.group(s.Tags["group"])
+	if checkName, ok := s.Tags["check"]; ok && s.Metric == "checks" {
+		check, ok := group.checks[checkName]
+		if !ok {
+			checkPath := group.path + groupPathSeparator + checkName
+			check = &Check{Name: checkName, Path: checkPath, ID: groupID(checkPath)}
+			group.checks[checkName] = check
+			group.checkOrder = append(group.checkOrder, checkName)
+		}
+		if s.Value != 0 {
+			check.Passes++
+		} else {
+			check.Fails++
+		}
+	}
+
+	return nil
+}
+
+// group finds or creates a group from its path, along with all of its parents
+func (a *aggregator) group(path string) *groupNode {
+	if node, ok := a.groups[path]; ok {
+		return node
+	}
+
+	parentPath := ""
+	name := strings.TrimPrefix(path, groupPathSeparator)
+	if i := strings.LastIndex(path, groupPathSeparator); i > 0 {
+		parentPath = path[:i]
+		name = path[i+len(groupPathSeparator):]
+	}
+	parent := a.group(parentPath)
+
+	node := &groupNode{name: name, path: path, checks: map[string]*Check{}}
+	a.groups[path] = node
+	parent.children = append(parent.children, path)
+	return node
+}
+
+// result computes the stats of every metric and builds the group tree, as if read from a summary
+func (a *aggregator) result() *ResultData {
+	duration := a.last.Sub(a.first)
+	resultData := &ResultData{
+		Metrics:   map[string]Metric{},
+		RootGroup: a.buildGroup(""),
+		Options:   Options{SummaryTrendStats: a.trendStats},
+		Timeline:  a.timeline.timeline(a.bucket),
+		Responses: a.responses.result(),
+		State: State{
+			TestRunDurationMs: float64(duration) / float64(time.Millisecond),
+			StartTime:         a.first,
+			EndTime:           a.last,
+		},
+	}
+
+	for name, sink := range a.sinks {
+		if sink.count == 0 && sink.tags != nil {
+			continue
+		}
+		metric := Metric{
+			Name:     name,
+			Type:     sink.kind.Type,
+			Contains: sink.kind.Contains,
+			Values:   sink.stats(a.trendStats, duration),
+		}
+		for i, expr := range sink.thresholds {
+			observed, ok := metric.Values[expr.SinkKey()]
+			metric.Thresholds = append(metric.Thresholds, Threshold{
+				Source:      sink.configs[i].Source,
+				OK:          ok && expr.Passes(observed),
+				AbortOnFail: sink.configs[i].AbortOnFail,
+			})
+		}
+		resultData.Metrics[name] = metric
+	}
+	if endpoints := a.endpoints.result(a.trendStats, duration); len(endpoints) > 0 {
+		for i := range endpoints {
+			endpoints[i].Apdex = a.scores.apdexOf(endpoints[i].Method, endpoints[i].Name)
+		}
+		resultData.Endpoints = endpoints
+	}
+	resultData.Apdex, resultData.SLOs = a.scores.result()
+	resultData.Capacity = capacity(resultData.Timeline, a.limits)
+	resultData.Drift = a.drift.result(resultData.Timeline)
+	resultData.Scenarios = a.scenarios.result(a.trendStats)
+
+	return resultData
+}
+
+func (a *aggregator) buildGroup(path string) Group {
+	node := a.groups[path]
+	group := Group{Name: node.name, Path: node.path, ID: groupID(node.path)}
+	for _, name := range node.checkOrder {
+		group.Checks = append(group.Checks, *node.checks[name])
+	}
+	for _, childPath := range node.children {
+		group.Groups = append(group.Groups, a.buildGroup(childPath))
+	}
+	return group
+}
+
+func (s *metricSink) addThresholds(configs []thresholdConfig) error {
+	for _, config := range configs {
+		expr, err := parseThresholdExpression(config.Source)
+		if err != nil {
+			return fmt.Errorf("metric %q: %w", s.name, err)
+		}
+		s.thresholds = append(s.thresholds, expr)
+		s.configs = append(s.configs, config)
+	}
+	return nil
+}
+
+func (s *metricSink) add(value float64) {
+	if s.count == 0 || value < s.min {
+		s.min = value
+	}
+	if s.count == 0 || value > s.max {
+		s.max = value
+	}
+	s.count++
+	s.sum += value
+	s.last = value
+	if value != 0 {
+		s.nonZero++
+	}
+	if s.kind.Type == "trend" {
+		s.values = append(s.values, value)
+		s.sorted = false
+	}
+}
+
+func (s *metricSink) matches(tags map[string]string) bool {
+	for key, value := range s.tags {
+		if tags[key] != value {
+			return false
+		}
+	}
+	return true
+}
+
+// stats computes the values K6 would report for this type of metric
+func (s *metricSink) stats(trendStats []string, duration time.Duration) map[string]float64 {
+	values := map[string]float64{}
+
+	switch s.kind.Type {
+	case "counter":
+		values["count"] = s.sum
+		values["rate"] = perSecond(s.sum, duration)
+	case "gauge":
+		values["value"] = s.last
+		values["min"] = s.min
+		values["max"] = s.max
+	case "rate":
+		values["rate"] = 0
+		if s.count > 0 {
+			values["rate"] = float64(s.nonZero) / float64(s.count)
+		}
+		values["passes"] = float64(s.nonZero)
+		values["fails"] = float64(s.count - s.nonZero)
+	case "trend":
+		stats := append([]string{}, trendStats...)
+		for _, expr := range s.thresholds {
+			stats = append(stats, expr.SinkKey())
+		}
+		for _, stat := range stats {
+			if value, ok := s.trendStat(stat); ok {
+				values[stat] = value
+			}
+		}
+	}
+
+	return values
+}
+
+// trendStat computes a single trend stat, e.g. "avg" or "p(99.9)"
+func (s *metricSink) trendStat(stat string) (float64, bool) {
+	switch stat {
+	case "avg":
+		if s.count == 0 {
+			return 0, true
+		}
+		return s.sum / float64(s.count), true
+	case "min":
+		return s.min, true
+	case "max":
+		return s.max, true
+	case "count":
+		return float64(s.count), true
+	case "med":
+		return s.percentile(0.5), true
+	}
+
+	method, pct, err := parseThresholdAggregationMethod(stat)
+	if err != nil || method != "p" {
+		return 0, false
+	}
+	return s.percentile(pct / 100), true
+}
+
+func (s *metricSink) percentile(pct float64) float64 {
+	if !s.sorted {
+		sort.Float64s(s.values)
+		s.sorted = true
+	}
+	return sortedPercentile(s.values, pct)
+}
+
+// sortedPercentile is calculated the same way as K6, with linear interpolation between the closest values
+func sortedPercentile(values []float64, pct float64) float64 {
+	switch len(values) {
+	case 0:
+		return 0
+	case 1:
+		return values[0]
+	}
+
+	i := pct * (float64(len(values)) - 1.0)
+	j := values[int(math.Floor(i))]
+	k := values[int(math.Ceil(i))]
+	f := i - math.Floor(i)
+	return j + (k-j)*f
+}
+
+func perSecond(value float64, duration time.Duration) float64 {
+	if duration <= 0 {
+		return 0
+	}
+	return value / duration.Seconds()
+}
+
+// parseSubmetricTags gets the tags from a submetric name, e.g. http_req_duration{status:200,method:GET}
+func parseSubmetricTags(name string) map[string]string {
+	tags := map[string]string{}
+	start := strings.Index(name, "{")
+	if start < 0 || !strings.HasSuffix(name, "}") {
+		return tags
+	}
+	for _, pair := range strings.Split(name[start+1:len(name)-1], ",") {
+		if i := strings.Index(pair, ":"); i > 0 {
+			tags[strings.TrimSpace(pair[:i])] = strings.TrimSpace(pair[i+1:])
+		}
+	}
+	return tags
+}
+
+func containsSink(sinks []*metricSink, sink *metricSink) bool {
+	for _, s := range sinks {
+		if s == sink {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"encoding/base64"
+	"flag"
+	"fmt"
+	"html/template"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Branding customises the HTML report, everything is inlined so the report is a single portable file
+type Branding struct {
+	Title       string       // Report title, from the title pattern
+	Org         string       // Organisation name shown next to the logo
+	Logo        template.URL // Logo image as a data URI, empty for no logo
+	Icon        template.URL // Favicon as a data URI, the logo if there is one
+	AccentColor string
+	PassColor   string
+	FailColor   string
+	Footer      string
+}
+
+// brandingOptions are the branding settings as given on the command line
+type brandingOptions struct {
+	TitlePattern string
+	Org          string
+	LogoFile     string
+	AccentColor  string
+	PassColor    string
+	FailColor    string
+	Footer       string
+}
+
+// Default title pattern, {title} is replaced with the title made from the input filename
+const defaultTitlePattern = "K6 Load Test: {title}"
+
+// The K6 logo, used as the favicon when there's no logo
+const defaultIcon = "data:image/svg+xml;base64,PHN2ZyB3aWR0aD0iNTAiIGhlaWdodD0iNDUiIHZpZXdCb3g9IjAgMCA1MCA0NSIgeG1sbnM9Imh0dHA6Ly93d3cudzMub3JnLzIwMDAvc3ZnIj48cGF0aCBkPSJNMzkuNTc1IDBMMjcuMTU0IDE2Ljg4MyAxNi43MjkgOS4zMSAwIDQ1aDUwTDM5LjU3NSAweiIgZmlsbD0iIzdENjRGRiIvPjwvc3ZnPg=="
+
+// Colours can be given as hex or by name, nothing that could escape the stylesheet
+var colorPattern = regexp.MustCompile(`^(#[0-9a-fA-F]{3,8}|[a-zA-Z]+)$`)
+
+// addBrandingFlags adds the branding flags to a flag set, commands have their own default title
+func addBrandingFlags(fs *flag.FlagSet, opts *brandingOptions, defaultTitle string) {
+	fs.StringVar(&opts.TitlePattern, "title", defaultTitle, "Report title, {title} is replaced with a title made from the input filename and {date} with today's date")
+	fs.StringVar(&opts.Org, "org", "", "Organisation name shown in the report header")
+	fs.StringVar(&opts.LogoFile, "logo", "", "Logo image file shown in the report header, inlined into the report")
+	fs.StringVar(&opts.AccentColor, "accent", "#5697e2", "Accent colour of the report")
+	fs.StringVar(&opts.PassColor, "passcolor", "#3abe3a", "Colour used for passing results")
+	fs.StringVar(&opts.FailColor, "failcolor", "#ff6666", "Colour used for failures")
+	fs.StringVar(&opts.Footer, "footer", "", "Footer text of the report")
+}
+
+// newBranding checks the branding options and inlines the logo
+func newBranding(opts brandingOptions, title string, now time.Time) (Branding, error) {
+	brand := Branding{
+		Org:         opts.Org,
+		Icon:        defaultIcon,
+		AccentColor: opts.AccentColor,
+		PassColor:   opts.PassColor,
+		FailColor:   opts.FailColor,
+		Footer:      opts.Footer,
+	}
+
+	pattern := opts.TitlePattern
+	if pattern == "" {
+		pattern = defaultTitlePattern
+	}
+	brand.Title = strings.NewReplacer("{title}", title, "{date}", now.Format("2006-01-02")).Replace(pattern)
+
+	for _, color := range []string{brand.AccentColor, brand.PassColor, brand.FailColor} {
+		if !colorPattern.MatchString(color) {
+			return brand, fmt.Errorf("invalid colour %q, use a hex value like #5697e2 or a colour name", color)
+		}
+	}
+
+	if opts.LogoFile != "" {
+		logo, err := dataURI(opts.LogoFile)
+		if err != nil {
+			return brand, err
+		}
+		brand.Logo = logo
+		brand.Icon = logo
+	}
+
+	return brand, nil
+}
+
+// dataURI reads an image file and encodes it as a data URI
+func dataURI(filename string) (template.URL, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return "", err
+	}
+
+	mimeType := http.DetectContentType(data)
+	if strings.EqualFold(filepath.Ext(filename), ".svg") {
+		mimeType = "image/svg+xml"
+	}
+	if !strings.HasPrefix(mimeType, "image/") {
+		return "", fmt.Errorf("logo %s is not an image, found %s", filename, mimeType)
+	}
+
+	return template.URL("data:" + mimeType + ";base64," + base64.StdEncoding.EncodeToString(data)), nil
+}
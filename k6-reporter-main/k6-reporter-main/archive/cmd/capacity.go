@@ -0,0 +1,303 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sort"
+)
+
+// Raw sample inputs of stress & break-point tests are analysed for the load the system can sustain
+//  1. The ramp up of the timeline, up to the end of the highest load, is grouped into load levels, by active VUs,
+//     or by the iteration arrival rate when the VUs hardly change, as with the arrival rate executors
+//  2. Going up the levels, the knee is the first level where the P95 or error rate crossed its limit,
+//     or where throughput stopped growing, i.e. levels with at least 10% more load added less than 5% more throughput
+//  3. The sustainable capacity is the level below a crossed limit, or the level throughput stopped growing at
+// Latency is averaged from the P95 & P99 of the time buckets in each level, weighted by their requests
+
+// Most load levels, more distinct loads than this are grouped into equal width levels
+const maxLoadLevels = 20
+
+// Fewest load levels worth analysing, fewer means the test didn't ramp the load
+const minLoadLevels = 4
+
+// Least extra throughput, as a fraction of a level's, the levels above it must add for throughput to still be growing
+const throughputGrowth = 0.05
+
+// Least extra load above a level, as a fraction of its load, to judge if throughput stopped growing, smaller steps are noise
+const minLoadStep = 0.1
+
+// Capacity is the estimated sustainable capacity of a stress test
+type Capacity struct {
+	LoadBy             string  // vus or rate, what the load levels are of
+	P95LimitMs         float64 // Limits a level can't cross, 0 when not set
+	ErrorLimit         float64
+	Levels             []LoadLevel
+	Knee               *LoadLevel // Where the system broke, nil when it didn't
+	KneeReason         string     // throughput, latency or errors
+	Sustainable        *LoadLevel // Highest load that was sustained, nil when the system broke at the lowest load
+	LatencyCorrelation float64    // Pearson correlation of load with P95, from -1 to 1
+	ErrorCorrelation   float64    // Pearson correlation of load with error rate
+}
+
+// LoadLevel is how the system did at one level of load
+type LoadLevel struct {
+	Load       float64 // Average active VUs, or iterations started per second
+	RPS        float64 // Throughput, of http_reqs
+	P95        float64 // Of http_req_duration
+	P99        float64
+	ErrorRate  float64 // Of http_req_failed, only known when HasErrors
+	HasErrors  bool
+	DurationMs float64 // Time spent at the level, during the ramp up
+	Breached   bool
+}
+
+// capacityLimits are the limits a load level has to stay within to be sustainable
+type capacityLimits struct {
+	P95        float64 // In ms, 0 for no limit
+	ErrorLimit float64 // Rate of http_req_failed, 0 for no limit
+}
+
+// capacity analyses the load levels of a timeline, nil when the load wasn't ramped through enough levels
+func capacity(timeline *Timeline, limits capacityLimits) *Capacity {
+	if timeline == nil || len(timeline.Buckets) == 0 {
+		return nil
+	}
+	// Offered load of each bucket, by VUs unless they barely change, then by iterations started per second
+	loadBy := "vus"
+	load := func(b TimelineBucket) float64 { return b.VUs }
+	minVUs, maxVUs := math.Inf(1), 0.0
+	for _, bucket := range timeline.Buckets {
+		if bucket.Requests > 0 {
+			minVUs, maxVUs = math.Min(minVUs, bucket.VUs), math.Max(maxVUs, bucket.VUs)
+		}
+	}
+	if maxVUs == 0 || maxVUs < 1.5*minVUs {
+		loadBy = "rate"
+		load = func(b TimelineBucket) float64 { return (b.Iterations + b.Dropped) / timeline.bucketSeconds(b) }
+	}
+
+	// Only the ramp up counts, the ramp down passes the same loads with the system maybe still recovering
+	peak, end := 0.0, 0
+	for i, bucket := range timeline.Buckets {
+		if value := load(bucket); value >= peak && bucket.Requests > 0 {
+			peak, end = value, i
+		}
+	}
+	buckets := []TimelineBucket{}
+	for _, bucket := range timeline.Buckets[:end+1] {
+		if bucket.Requests > 0 && load(bucket) > 0 {
+			buckets = append(buckets, bucket)
+		}
+	}
+	levels := loadLevels(buckets, load, timeline.bucketSeconds)
+	if len(levels) < minLoadLevels {
+		return nil
+	}
+
+	result := &Capacity{LoadBy: loadBy, P95LimitMs: limits.P95, ErrorLimit: limits.ErrorLimit, Levels: levels}
+	loads, p95s, errorRates := []float64{}, []float64{}, []float64{}
+	for i := range levels {
+		level := &levels[i]
+		level.Breached = (limits.P95 > 0 && level.P95 > limits.P95) || (limits.ErrorLimit > 0 && level.HasErrors && level.ErrorRate > limits.ErrorLimit)
+		loads, p95s, errorRates = append(loads, level.Load), append(p95s, level.P95), append(errorRates, level.ErrorRate)
+	}
+	result.LatencyCorrelation = correlation(loads, p95s)
+	result.ErrorCorrelation = correlation(loads, errorRates)
+
+	sustainable := len(levels) - 1
+	for i, level := range levels {
+		if level.Breached {
+			result.KneeReason = "latency"
+			if limits.P95 <= 0 || level.P95 <= limits.P95 {
+				result.KneeReason = "errors"
+			}
+			sustainable = i - 1
+			result.Knee = &levels[i]
+			break
+		}
+		if plateaued(levels, i) {
+			result.KneeReason = "throughput"
+			sustainable = i
+			result.Knee = &levels[i]
+			break
+		}
+	}
+	if sustainable >= 0 {
+		result.Sustainable = &levels[sustainable]
+	}
+	return result
+}
+
+// plateaued checks if throughput stopped growing at a level, the levels with meaningfully more load didn't add throughput
+// A linear ramp that never saturated adds throughput all the way up, so it never plateaus
+func plateaued(levels []LoadLevel, i int) bool {
+	laterLoad, laterRPS := 0.0, 0.0
+	for _, later := range levels[i+1:] {
+		laterLoad, laterRPS = math.Max(laterLoad, later.Load), math.Max(laterRPS, later.RPS)
+	}
+	return laterLoad >= levels[i].Load*(1+minLoadStep) && laterRPS < levels[i].RPS*(1+throughputGrowth)
+}
+
+// loadLevels groups buckets by their load, into levels of equal width when there are too many distinct loads
+func loadLevels(buckets []TimelineBucket, load, seconds func(TimelineBucket) float64) []LoadLevel {
+	if len(buckets) == 0 {
+		return nil
+	}
+	distinct := map[float64]bool{}
+	minLoad, maxLoad := math.Inf(1), 0.0
+	for _, bucket := range buckets {
+		value := math.Round(load(bucket))
+		distinct[value] = true
+		minLoad, maxLoad = math.Min(minLoad, value), math.Max(maxLoad, value)
+	}
+	level := func(b TimelineBucket) float64 { return math.Round(load(b)) }
+	if len(distinct) > maxLoadLevels {
+		width := (maxLoad - minLoad) / maxLoadLevels
+		level = func(b TimelineBucket) float64 {
+			return math.Min(math.Floor((math.Round(load(b))-minLoad)/width), maxLoadLevels-1)
+		}
+	}
+
+	type totals struct {
+		load, seconds, requests, p95, p99, failed, failedSamples float64
+		buckets                                                  int
+	}
+	groups := map[float64]*totals{}
+	keys := []float64{}
+	for _, bucket := range buckets {
+		key := level(bucket)
+		group, ok := groups[key]
+		if !ok {
+			group = &totals{}
+			groups[key] = group
+			keys = append(keys, key)
+		}
+		group.load += load(bucket)
+		group.seconds += seconds(bucket)
+		group.requests += bucket.Requests
+		group.p95 += bucket.P95 * bucket.Requests
+		group.p99 += bucket.P99 * bucket.Requests
+		group.failed += bucket.Failed
+		group.failedSamples += bucket.FailedSamples
+		group.buckets++
+	}
+	sort.Float64s(keys)
+
+	levels := make([]LoadLevel, 0, len(keys))
+	for _, key := range keys {
+		group := groups[key]
+		level := LoadLevel{
+			Load:       group.load / float64(group.buckets),
+			RPS:        group.requests / group.seconds,
+			P95:        group.p95 / group.requests,
+			P99:        group.p99 / group.requests,
+			HasErrors:  group.failedSamples > 0,
+			DurationMs: group.seconds * 1000,
+		}
+		if level.HasErrors {
+			level.ErrorRate = group.failed / group.failedSamples
+		}
+		levels = append(levels, level)
+	}
+	return levels
+}
+
+// correlation is the Pearson correlation coefficient of two series, 0 when either doesn't vary
+func correlation(xs, ys []float64) float64 {
+	n := float64(len(xs))
+	if n < 2 {
+		return 0
+	}
+	meanX, meanY := 0.0, 0.0
+	for i := range xs {
+		meanX += xs[i] / n
+		meanY += ys[i] / n
+	}
+	covariance, varianceX, varianceY := 0.0, 0.0, 0.0
+	for i := range xs {
+		dx, dy := xs[i]-meanX, ys[i]-meanY
+		covariance += dx * dy
+		varianceX += dx * dx
+		varianceY += dy * dy
+	}
+	if varianceX == 0 || varianceY == 0 {
+		return 0
+	}
+	return covariance / math.Sqrt(varianceX*varianceY)
+}
+
+// capacityCharts draws throughput, latency & error rate against load, with the knee & any limits marked
+func capacityCharts(locale *Locale, capacity *Capacity) []Chart {
+	if capacity == nil {
+		return nil
+	}
+	loadFormat := func(x float64) string { return locale.FormatNumber(x, 0) + " " + locale.T("vus") }
+	if capacity.LoadBy == "rate" {
+		loadFormat = func(x float64) string { return locale.FormatNumber(x, 1) + "/s" }
+	}
+	perSecond := func(v float64) string { return locale.FormatNumber(v, 1) + "/s" }
+	milliseconds := func(v float64) string { return formatMs(locale, v) }
+	percentage := func(v float64) string { return locale.FormatNumber(v*100, 1) + "%" }
+
+	series := func(name string, format func(float64) string, value func(LoadLevel) (float64, bool)) chartSeries {
+		s := chartSeries{Name: name}
+		for _, level := range capacity.Levels {
+			if y, ok := value(level); ok {
+				s.Points = append(s.Points, chartPoint{X: level.Load, Y: y, Label: loadFormat(level.Load) + ": " + format(y)})
+			}
+		}
+		return s
+	}
+	// Flat line of a limit across every load, or a vertical line at the knee up to the top of a series
+	limit := func(name string, format func(float64) string, value float64) chartSeries {
+		first, last := capacity.Levels[0].Load, capacity.Levels[len(capacity.Levels)-1].Load
+		return chartSeries{Name: name, Points: []chartPoint{
+			{X: first, Y: value, Label: name + ": " + format(value)},
+			{X: last, Y: value, Label: name + ": " + format(value)},
+		}}
+	}
+	knee := func(top float64) []chartSeries {
+		if capacity.Knee == nil {
+			return nil
+		}
+		label := locale.T("knee") + ": " + loadFormat(capacity.Knee.Load)
+		return []chartSeries{{Name: locale.T("knee"), Points: []chartPoint{
+			{X: capacity.Knee.Load, Y: 0, Label: label},
+			{X: capacity.Knee.Load, Y: top, Label: label},
+		}}}
+	}
+	top := func(s chartSeries) float64 {
+		highest := 0.0
+		for _, p := range s.Points {
+			highest = math.Max(highest, p.Y)
+		}
+		return highest
+	}
+
+	charts := []Chart{}
+	add := func(title string, format func(float64) string, lines []chartSeries) {
+		charts = append(charts, Chart{Title: title, SVG: lineChart(title, lines, format, loadFormat)})
+	}
+
+	throughput := series(locale.T("http_reqs"), perSecond, func(l LoadLevel) (float64, bool) { return l.RPS, true })
+	add(fmt.Sprintf("%s / %s", locale.T("rps"), locale.T("load")), perSecond, append([]chartSeries{throughput}, knee(top(throughput))...))
+
+	latency := []chartSeries{
+		series(statLabel(locale, "p(95)"), milliseconds, func(l LoadLevel) (float64, bool) { return l.P95, true }),
+		series(statLabel(locale, "p(99)"), milliseconds, func(l LoadLevel) (float64, bool) { return l.P99, true }),
+	}
+	if capacity.P95LimitMs > 0 {
+		latency = append(latency, limit(locale.T("limit"), milliseconds, capacity.P95LimitMs))
+	}
+	add(fmt.Sprintf("%s / %s", locale.T("latency"), locale.T("load")), milliseconds, append(latency, knee(math.Max(top(latency[1]), capacity.P95LimitMs))...))
+
+	errors := series(locale.T("http_req_failed"), percentage, func(l LoadLevel) (float64, bool) { return l.ErrorRate, l.HasErrors })
+	if len(errors.Points) > 0 {
+		lines := []chartSeries{errors}
+		if capacity.ErrorLimit > 0 {
+			lines = append(lines, limit(locale.T("limit"), percentage, capacity.ErrorLimit))
+		}
+		add(fmt.Sprintf("%s / %s", locale.T("errorRate"), locale.T("load")), percentage, append(lines, knee(math.Max(top(errors), capacity.ErrorLimit))...))
+	}
+	return charts
+}
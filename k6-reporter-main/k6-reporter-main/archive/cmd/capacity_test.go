@@ -0,0 +1,116 @@
+package main
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+// rampTimeline ramps from 1 to maxVUs, one VU more every 10s bucket, with the throughput, P95 & error rate at each VU count
+func rampTimeline(maxVUs int, rps, p95, errorRate func(vus float64) float64) *Timeline {
+	start := time.Date(2025, 1, 1, 3, 0, 0, 0, time.UTC)
+	timeline := &Timeline{BucketMs: 10000}
+	for i := 1; i <= maxVUs; i++ {
+		vus := float64(i)
+		requests := rps(vus) * 10
+		timeline.Buckets = append(timeline.Buckets, TimelineBucket{
+			Time:          start.Add(time.Duration(i) * 10 * time.Second),
+			VUs:           vus,
+			Requests:      requests,
+			P95:           p95(vus),
+			P99:           p95(vus) * 1.2,
+			Failed:        math.Round(errorRate(vus) * requests),
+			FailedSamples: requests,
+		})
+	}
+	return timeline
+}
+
+func TestCapacity(t *testing.T) {
+	flat := func(v float64) func(float64) float64 { return func(float64) float64 { return v } }
+	linear := func(vus float64) float64 { return 5 * vus }
+
+	tests := []struct {
+		name            string
+		timeline        *Timeline
+		limits          capacityLimits
+		wantReason      string  // Empty for no knee
+		wantKnee        float64 // Load of the knee
+		wantSustainable float64 // Load of the sustainable level, 0 for none
+	}{
+		{
+			name:            "linear ramp that never saturated",
+			timeline:        rampTimeline(40, linear, flat(100), flat(0)),
+			limits:          capacityLimits{P95: 500, ErrorLimit: 0.01},
+			wantSustainable: 39.5,
+		},
+		{
+			name:            "linear ramp of 20 levels",
+			timeline:        rampTimeline(20, linear, flat(100), flat(0)),
+			limits:          capacityLimits{ErrorLimit: 0.01},
+			wantSustainable: 20,
+		},
+		{
+			name: "throughput saturated",
+			timeline: rampTimeline(20, func(vus float64) float64 { return math.Min(5*vus, 60) }, func(vus float64) float64 {
+				return 10 * vus
+			}, flat(0)),
+			wantReason:      "throughput",
+			wantKnee:        12,
+			wantSustainable: 12,
+		},
+		{
+			name:            "latency breached",
+			timeline:        rampTimeline(20, linear, func(vus float64) float64 { return 20 * vus }, flat(0)),
+			limits:          capacityLimits{P95: 250},
+			wantReason:      "latency",
+			wantKnee:        13,
+			wantSustainable: 12,
+		},
+		{
+			name:            "errors breached",
+			timeline:        rampTimeline(20, linear, flat(100), func(vus float64) float64 { return 0.01 * math.Max(vus-10, 0) }),
+			limits:          capacityLimits{ErrorLimit: 0.055},
+			wantReason:      "errors",
+			wantKnee:        16,
+			wantSustainable: 15,
+		},
+		{
+			name:       "breached at the lowest load",
+			timeline:   rampTimeline(20, linear, flat(900), flat(0)),
+			limits:     capacityLimits{P95: 500},
+			wantReason: "latency",
+			wantKnee:   1,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			result := capacity(test.timeline, test.limits)
+			if result == nil {
+				t.Fatal("got no capacity")
+			}
+			if result.KneeReason != test.wantReason {
+				t.Errorf("got knee reason %q, want %q", result.KneeReason, test.wantReason)
+			}
+			if test.wantReason == "" && result.Knee != nil {
+				t.Errorf("got a knee at %g, want none", result.Knee.Load)
+			}
+			if test.wantReason != "" && (result.Knee == nil || result.Knee.Load != test.wantKnee) {
+				t.Errorf("got knee %+v, want one at %g", result.Knee, test.wantKnee)
+			}
+			if test.wantSustainable == 0 && result.Sustainable != nil {
+				t.Errorf("got sustainable %g, want none", result.Sustainable.Load)
+			}
+			if test.wantSustainable != 0 && (result.Sustainable == nil || result.Sustainable.Load != test.wantSustainable) {
+				t.Errorf("got sustainable %+v, want %g", result.Sustainable, test.wantSustainable)
+			}
+		})
+	}
+}
+
+func TestCapacityNotRamped(t *testing.T) {
+	timeline := rampTimeline(3, func(vus float64) float64 { return vus }, func(float64) float64 { return 100 }, func(float64) float64 { return 0 })
+	if result := capacity(timeline, capacityLimits{}); result != nil {
+		t.Errorf("got capacity of %d levels, want none", len(result.Levels))
+	}
+}
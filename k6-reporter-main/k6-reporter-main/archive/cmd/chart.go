@@ -0,0 +1,117 @@
+package main
+
+import (
+	"fmt"
+	"html"
+	"html/template"
+	"math"
+	"strings"
+)
+
+// Simple inline SVG line charts, so reports with charts are still a single self contained file
+
+// Size of a chart, the SVG scales to the width of the page
+const (
+	chartWidth   = 800
+	chartHeight  = 240
+	chartPadLeft = 70
+	chartPadTop  = 15
+	chartPadEnd  = 15
+	chartPadBase = 35
+)
+
+// Colours of the series of a chart, the first is the report accent colour
+var chartColors = []string{"var(--accent)", "#e8a33d", "#8e5ae2", "#3abe3a", "#e25a8e", "#5ae2d6"}
+
+// Chart is a titled chart, rendered as inline SVG
+type Chart struct {
+	Title string
+	SVG   template.HTML
+}
+
+// chartSeries is a named line on a chart
+type chartSeries struct {
+	Name   string
+	Points []chartPoint
+}
+
+// chartPoint is a point on a chart, the label is shown when hovering over it
+type chartPoint struct {
+	X     float64
+	Y     float64
+	Label string
+}
+
+// lineChart renders series as an SVG line chart, yFormat formats the Y axis values & xFormat the X axis
+func lineChart(title string, series []chartSeries, yFormat, xFormat func(float64) string) template.HTML {
+	minX, maxX := math.Inf(1), math.Inf(-1)
+	maxY := 0.0
+	for _, s := range series {
+		for _, p := range s.Points {
+			minX, maxX = math.Min(minX, p.X), math.Max(maxX, p.X)
+			maxY = math.Max(maxY, p.Y)
+		}
+	}
+	if math.IsInf(minX, 1) {
+		return ""
+	}
+	if maxX == minX {
+		maxX = minX + 1
+	}
+	maxY = niceCeiling(maxY)
+
+	plotWidth := float64(chartWidth - chartPadLeft - chartPadEnd)
+	plotHeight := float64(chartHeight - chartPadTop - chartPadBase)
+	x := func(v float64) float64 { return chartPadLeft + (v-minX)/(maxX-minX)*plotWidth }
+	y := func(v float64) float64 { return chartPadTop + plotHeight - v/maxY*plotHeight }
+
+	svg := &strings.Builder{}
+	fmt.Fprintf(svg, `<svg class="chart" viewBox="0 0 %d %d" role="img" aria-label="%s">`, chartWidth, chartHeight, html.EscapeString(title))
+
+	// Grid lines & Y axis labels at quarters of the maximum
+	for i := 0; i <= 4; i++ {
+		value := maxY * float64(i) / 4
+		fmt.Fprintf(svg, `<line class="grid" x1="%d" x2="%d" y1="%.1f" y2="%.1f"/>`, chartPadLeft, chartWidth-chartPadEnd, y(value), y(value))
+		fmt.Fprintf(svg, `<text class="axis" x="%d" y="%.1f" text-anchor="end">%s</text>`, chartPadLeft-6, y(value)+4, html.EscapeString(yFormat(value)))
+	}
+	// X axis labels at the start, middle & end
+	for i, anchor := range []string{"start", "middle", "end"} {
+		value := minX + (maxX-minX)*float64(i)/2
+		fmt.Fprintf(svg, `<text class="axis" x="%.1f" y="%d" text-anchor="%s">%s</text>`, x(value), chartHeight-10, anchor, html.EscapeString(xFormat(value)))
+	}
+
+	for i, s := range series {
+		color := chartColors[i%len(chartColors)]
+		points := make([]string, 0, len(s.Points))
+		for _, p := range s.Points {
+			points = append(points, fmt.Sprintf("%.1f,%.1f", x(p.X), y(p.Y)))
+		}
+		fmt.Fprintf(svg, `<polyline style="fill: none; stroke: %s; stroke-width: 2" points="%s"/>`, color, strings.Join(points, " "))
+		// Only mark individual points when there's room to see them
+		if len(s.Points) <= 100 {
+			for _, p := range s.Points {
+				fmt.Fprintf(svg, `<circle cx="%.1f" cy="%.1f" r="3" style="fill: %s"><title>%s</title></circle>`, x(p.X), y(p.Y), color, html.EscapeString(p.Label))
+			}
+		}
+		if len(series) > 1 {
+			fmt.Fprintf(svg, `<text class="legend" x="%d" y="%d" style="fill: %s">%s</text>`, chartPadLeft+10+i*150, chartPadTop+12, color, html.EscapeString(s.Name))
+		}
+	}
+
+	svg.WriteString(`</svg>`)
+	return template.HTML(svg.String())
+}
+
+// niceCeiling rounds a maximum up to a round number, so axis labels are readable
+func niceCeiling(value float64) float64 {
+	if value <= 0 {
+		return 1
+	}
+	magnitude := math.Pow(10, math.Floor(math.Log10(value)))
+	for _, step := range []float64{1, 2, 2.5, 5, 10} {
+		if value <= step*magnitude {
+			return step * magnitude
+		}
+	}
+	return 10 * magnitude
+}
@@ -0,0 +1,462 @@
+package main
+
+import (
+	"bytes"
+	_ "embed"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"html/template"
+	"math"
+	"os"
+	"sort"
+	textTemplate "text/template"
+	"time"
+
+	"github.com/Masterminds/sprig/v3"
+)
+
+// The compare command diffs a candidate run against a baseline run, e.g. after a deploy against the one before
+// Every stat of every metric, and the pass rate of every group & check, is compared and given a verdict:
+//  - changes within the warn tolerance are unchanged
+//  - changes the better way are improvements, changes the worse way are warnings or regressions past the fail tolerance
+//  - metrics where neither way is better, e.g. vus, are just changed
+// Changes are relative (percent of the baseline), except rates which change by percentage points
+
+//go:embed "templates/compare.tmpl"
+var compareTemplateString string
+
+//go:embed "templates/compare.md.tmpl"
+var compareMarkdownTemplateString string
+
+// Default title pattern of comparison reports
+const defaultCompareTitlePattern = "K6 Comparison: {title}"
+
+// Verdicts of a compared stat
+const (
+	verdictUnchanged = "unchanged"
+	verdictImproved  = "improved"
+	verdictWarning   = "warning"
+	verdictRegressed = "regressed"
+	verdictChanged   = "changed" // For stats where neither way is better
+	verdictAdded     = "added"   // Only in the candidate
+	verdictRemoved   = "removed" // Only in the baseline
+)
+
+// Which way is better for built in metrics, 1 is higher & -1 is lower, trends & rates are lower unless listed here
+var metricDirections = map[string]int{
+	"checks":             1,
+	"http_reqs":          1,
+	"iterations":         1,
+	"dropped_iterations": -1,
+}
+
+// Comparison is the difference between a baseline & candidate run
+type Comparison struct {
+	Title        string       `json:"title"`
+	Brand        Branding     `json:"-"`
+	Generated    time.Time    `json:"generated"`
+	Baseline     RunInfo      `json:"baseline"`
+	Candidate    RunInfo      `json:"candidate"`
+	Tolerance    Tolerance    `json:"tolerance"`
+	Metrics      []MetricDiff `json:"metrics"`
+	Groups       []CheckDiff  `json:"groups"` // Pass rates of groups, rolled up from all checks under them
+	Checks       []CheckDiff  `json:"checks"`
+	Regressions  int          `json:"regressions"`
+	Warnings     int          `json:"warnings"`
+	Improvements int          `json:"improvements"`
+}
+
+// RunInfo describes one of the compared runs
+type RunInfo struct {
+	File       string  `json:"file"`
+	Format     string  `json:"format"`
+	DurationMs float64 `json:"durationMs"`
+}
+
+// Tolerance bands in percent, or percentage points for rates
+type Tolerance struct {
+	Warn float64 `json:"warn"` // Changes within this are unchanged
+	Fail float64 `json:"fail"` // Changes the worse way past this are regressions, otherwise warnings
+}
+
+// MetricDiff is the comparison of every stat of a metric
+type MetricDiff struct {
+	Name     string     `json:"name"`
+	Type     string     `json:"type"`
+	Contains string     `json:"contains"`
+	Stats    []StatDiff `json:"stats"`
+	Metric   Metric     `json:"-"` // The candidate metric, or baseline if it's not in the candidate, for formatting values
+}
+
+// StatDiff is the comparison of a single stat, Delta is candidate minus baseline
+type StatDiff struct {
+	Stat      string  `json:"stat"`
+	Baseline  float64 `json:"baseline"`
+	Candidate float64 `json:"candidate"`
+	Delta     float64 `json:"delta"`
+	Change    float64 `json:"change"` // Percent of the baseline, or percentage points for rates
+	Points    bool    `json:"points"` // True when the change is in percentage points
+	Verdict   string  `json:"verdict"`
+}
+
+// CheckDiff is the comparison of the pass rate of a check or group
+type CheckDiff struct {
+	Group     string  `json:"group"`
+	Name      string  `json:"name,omitempty"`
+	Baseline  float64 `json:"baseline"`  // Pass rate
+	Candidate float64 `json:"candidate"` // Pass rate
+	Change    float64 `json:"change"`    // Percentage points
+	Verdict   string  `json:"verdict"`
+}
+
+// runCompare is the compare command
+func runCompare(args []string) {
+	fs := flag.NewFlagSet("compare", flag.ExitOnError)
+	var baselineFile = fs.String("baseline", "", "Baseline results file, in any input format")
+	var candidateFile = fs.String("candidate", "", "Candidate results file, in any input format")
+	var outFilename = fs.String("outfile", "./compare.html", "Output HTML filename, set to empty to skip the HTML report")
+	var markdownFilename = fs.String("markdown", "", "Output Markdown filename")
+	var jsonFilename = fs.String("json", "", "Output JSON filename")
+	var tolerance = Tolerance{}
+	fs.Float64Var(&tolerance.Warn, "warn", 5, "Tolerance in percent (points for rates), changes within it are unchanged")
+	fs.Float64Var(&tolerance.Fail, "fail", 10, "Tolerance in percent (points for rates), worse changes past it are regressions")
+	var brandOpts = brandingOptions{}
+	addBrandingFlags(fs, &brandOpts, defaultCompareTitlePattern)
+	var inFlags = addInputFlags(fs)
+	var localeFlags = addLocaleFlags(fs)
+	_ = fs.Parse(args)
+	if *baselineFile == "" || *candidateFile == "" {
+		fmt.Printf("\n🚫 Results to compare not specified, please add -baseline and -candidate\n\n")
+		fs.PrintDefaults()
+		os.Exit(1)
+	}
+	if tolerance.Fail < tolerance.Warn {
+		fmt.Printf("\n🚫 The -fail tolerance can't be less than -warn\n\n")
+		os.Exit(1)
+	}
+
+	inOpts, err := inFlags.options()
+	if err != nil {
+		fmt.Println("💥 Input options error", err)
+		os.Exit(1)
+	}
+	locale, zone, err := localeFlags.resolve()
+	if err != nil {
+		fmt.Println("💥 Locale error", err)
+		os.Exit(1)
+	}
+
+	baseline, baselineFormat, err := readResults(*baselineFile, inOpts)
+	if err != nil {
+		fmt.Println("💥 Baseline file error", err)
+		os.Exit(1)
+	}
+	fmt.Printf("\n📂 Read baseline %s from: %s\n", baselineFormat, *baselineFile)
+	candidate, candidateFormat, err := readResults(*candidateFile, inOpts)
+	if err != nil {
+		fmt.Println("💥 Candidate file error", err)
+		os.Exit(1)
+	}
+	fmt.Printf("\n📂 Read candidate %s from: %s\n", candidateFormat, *candidateFile)
+
+	comparison := compareResults(baseline, candidate, tolerance)
+	comparison.Baseline = RunInfo{File: *baselineFile, Format: baselineFormat, DurationMs: baseline.State.TestRunDurationMs}
+	comparison.Candidate = RunInfo{File: *candidateFile, Format: candidateFormat, DurationMs: candidate.State.TestRunDurationMs}
+	comparison.Title = candidate.Title
+	comparison.Generated = time.Now()
+	comparison.Brand, err = newBranding(brandOpts, comparison.Title, comparison.Generated)
+	if err != nil {
+		fmt.Println("💥 Branding error", err)
+		os.Exit(1)
+	}
+	fmt.Printf("\n⚖️  %d regressions, %d warnings, %d improvements\n", comparison.Regressions, comparison.Warnings, comparison.Improvements)
+
+	if *jsonFilename != "" {
+		out, err := json.MarshalIndent(comparison, "", "  ")
+		if err == nil {
+			err = os.WriteFile(*jsonFilename, out, 0o644)
+		}
+		if err != nil {
+			fmt.Println("💥 JSON output error", err)
+			os.Exit(1)
+		}
+		fmt.Printf("\n🧾 JSON written to: %s\n", *jsonFilename)
+	}
+
+	if *markdownFilename != "" {
+		if err := writeCompareMarkdown(*markdownFilename, comparison); err != nil {
+			fmt.Println("💥 Markdown output error", err)
+			os.Exit(1)
+		}
+		fmt.Printf("\n📝 Markdown written to: %s\n", *markdownFilename)
+	}
+
+	if *outFilename == "" {
+		return
+	}
+	tmpl, err := newCompareTemplate(locale, zone)
+	if err != nil {
+		fmt.Println("💥 Template file error", err)
+		os.Exit(1)
+	}
+	outFile, err := os.Create(*outFilename)
+	if err != nil {
+		fmt.Println("💥 Output file error", err)
+		os.Exit(1)
+	}
+	if err := tmpl.Execute(outFile, comparison); err != nil {
+		fmt.Println("💥 Template error", err)
+		os.Exit(1)
+	}
+	fmt.Printf("\n📜 Done! Output HTML written to: %s\n", outFile.Name())
+}
+
+// compareResults compares every metric, group & check found in either run
+func compareResults(baseline, candidate *ResultData, tolerance Tolerance) *Comparison {
+	comparison := &Comparison{Tolerance: tolerance}
+
+	names := sortedMetricNames(baseline.Metrics)
+	for _, name := range sortedMetricNames(candidate.Metrics) {
+		if _, ok := baseline.Metrics[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		base, inBase := baseline.Metrics[name]
+		cand, inCand := candidate.Metrics[name]
+		metric := cand
+		if !inCand {
+			metric = base
+		}
+		diff := MetricDiff{Name: name, Type: metric.Type, Contains: metric.Contains, Metric: metric}
+
+		for _, stat := range comparedStats(metric.Type, base, cand) {
+			baseValue, inBaseStat := base.Values[stat]
+			candValue, inCandStat := cand.Values[stat]
+			statDiff := StatDiff{Stat: stat, Baseline: baseValue, Candidate: candValue, Delta: candValue - baseValue}
+			switch {
+			case !inBase || !inBaseStat:
+				statDiff.Verdict = verdictAdded
+			case !inCand || !inCandStat:
+				statDiff.Verdict = verdictRemoved
+			default:
+				statDiff.Points = metric.Type == "rate" && stat == "rate"
+				statDiff.Change = relativeChange(baseValue, candValue, statDiff.Points)
+				statDiff.Verdict = tolerance.verdict(statDirection(name, metric.Type, stat), statDiff.Change)
+			}
+			comparison.count(statDiff.Verdict)
+			diff.Stats = append(diff.Stats, statDiff)
+		}
+		comparison.Metrics = append(comparison.Metrics, diff)
+	}
+
+	baseGroups, candGroups := map[string]Group{}, map[string]Group{}
+	collectGroups(baseline.RootGroup, baseGroups)
+	collectGroups(candidate.RootGroup, candGroups)
+	for _, path := range unionKeys(baseGroups, candGroups) {
+		base, inBase := baseGroups[path]
+		cand, inCand := candGroups[path]
+		diff := compareCounts(tolerance, base.Passes, base.Fails, inBase, cand.Passes, cand.Fails, inCand)
+		diff.Group = groupLabel(path)
+		comparison.count(diff.Verdict)
+		comparison.Groups = append(comparison.Groups, diff)
+
+		baseChecks, candChecks := map[string]Check{}, map[string]Check{}
+		for _, check := range base.Checks {
+			baseChecks[check.Name] = check
+		}
+		for _, check := range cand.Checks {
+			candChecks[check.Name] = check
+		}
+		for _, name := range unionCheckNames(baseChecks, candChecks) {
+			baseCheck, inBase := baseChecks[name]
+			candCheck, inCand := candChecks[name]
+			diff := compareCounts(tolerance, baseCheck.Passes, baseCheck.Fails, inBase, candCheck.Passes, candCheck.Fails, inCand)
+			diff.Group, diff.Name = groupLabel(path), name
+			comparison.count(diff.Verdict)
+			comparison.Checks = append(comparison.Checks, diff)
+		}
+	}
+
+	return comparison
+}
+
+// count adds up the verdicts that matter
+func (c *Comparison) count(verdict string) {
+	switch verdict {
+	case verdictRegressed:
+		c.Regressions++
+	case verdictWarning:
+		c.Warnings++
+	case verdictImproved:
+		c.Improvements++
+	}
+}
+
+// verdict decides what a change means, given which way is better for the stat
+func (t Tolerance) verdict(direction int, change float64) string {
+	magnitude := math.Abs(change)
+	switch {
+	case magnitude <= t.Warn:
+		return verdictUnchanged
+	case direction == 0:
+		return verdictChanged
+	case change*float64(direction) > 0:
+		return verdictImproved
+	case magnitude > t.Fail:
+		return verdictRegressed
+	}
+	return verdictWarning
+}
+
+// compareCounts compares pass rates from counts of passes & fails, lower pass rates are worse
+func compareCounts(tolerance Tolerance, basePasses, baseFails int, inBase bool, candPasses, candFails int, inCand bool) CheckDiff {
+	diff := CheckDiff{Baseline: passRate(basePasses, baseFails), Candidate: passRate(candPasses, candFails)}
+	switch {
+	case !inBase:
+		diff.Verdict = verdictAdded
+	case !inCand:
+		diff.Verdict = verdictRemoved
+	default:
+		diff.Change = relativeChange(diff.Baseline, diff.Candidate, true)
+		diff.Verdict = tolerance.verdict(1, diff.Change)
+	}
+	return diff
+}
+
+// relativeChange is the change in percent of the baseline, or in percentage points for rates
+// A change from zero can't be relative, so it's taken as a 100% change, the gate treats it as bigger than any limit
+func relativeChange(baseline, candidate float64, points bool) float64 {
+	switch {
+	case points:
+		return (candidate - baseline) * 100
+	case baseline != 0:
+		return (candidate - baseline) / math.Abs(baseline) * 100
+	case candidate > 0:
+		return 100
+	case candidate < 0:
+		return -100
+	}
+	return 0
+}
+
+// statDirection is which way is better for a stat, 1 is higher, -1 is lower and 0 is neither
+// Only the rate of a rate metric has a direction, its passes & fails go up and down with the amount of samples
+func statDirection(name, metricType, stat string) int {
+	switch {
+	case metricType == "gauge", metricType == "trend" && stat == "count", metricType == "rate" && stat != "rate":
+		return 0
+	}
+	if direction, ok := metricDirections[baseMetricName(name)]; ok {
+		return direction
+	}
+	if metricType == "trend" || metricType == "rate" {
+		return -1
+	}
+	return 0
+}
+
+// comparedStats lists every stat in either version of a metric, in the order they're usually shown
+func comparedStats(metricType string, base, cand Metric) []string {
+	found := map[string]bool{}
+	for stat := range base.Values {
+		found[stat] = true
+	}
+	for stat := range cand.Values {
+		found[stat] = true
+	}
+
+	order := trendStatOrder
+	if metricType != "trend" {
+		order = metricTypeStats[metricType]
+	}
+	return orderStats(found, order)
+}
+
+// collectGroups maps every group in a tree by its path, including the root group
+func collectGroups(group Group, groups map[string]Group) {
+	groups[group.Path] = group
+	for _, child := range group.Groups {
+		collectGroups(child, groups)
+	}
+}
+
+// groupLabel is the readable path of a group, with a name for the root group
+func groupLabel(path string) string {
+	if path == "" {
+		return "(root)"
+	}
+	return groupPathLabel(path)
+}
+
+// unionKeys lists the group paths in either map, sorted
+func unionKeys(a, b map[string]Group) []string {
+	keys := []string{}
+	for key := range a {
+		keys = append(keys, key)
+	}
+	for key := range b {
+		if _, ok := a[key]; !ok {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// unionCheckNames lists the check names in either map, sorted
+func unionCheckNames(a, b map[string]Check) []string {
+	names := []string{}
+	for name := range a {
+		names = append(names, name)
+	}
+	for name := range b {
+		if _, ok := a[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// passRate is the fraction of passes, zero when there were none at all
+func passRate(passes, fails int) float64 {
+	if passes+fails == 0 {
+		return 0
+	}
+	return float64(passes) / float64(passes+fails)
+}
+
+// newCompareTemplate parses the comparison template, along with the report template it shares styles & icons with
+func newCompareTemplate(locale *Locale, zone *time.Location) (*template.Template, error) {
+	tmpl, err := newReportTemplate("", locale, zone)
+	if err != nil {
+		return nil, err
+	}
+	return tmpl.Parse(compareTemplateString)
+}
+
+// writeCompareMarkdown renders a comparison as Markdown, e.g. for a merge request comment
+func writeCompareMarkdown(filename string, comparison *Comparison) error {
+	english := locales["en"]
+	tmpl, err := textTemplate.New("").Funcs(sprig.TxtFuncMap()).Funcs(textTemplate.FuncMap{
+		"mdEscape": markdownEscape,
+		"fmtValue": func(metric Metric, stat string, value float64) string {
+			return formatStatValue(english, metric, stat, value)
+		},
+		"percent": func(v float64) string { return english.FormatNumber(v*100, 2) + "%" },
+		"num":     func(v float64, decimals int) string { return english.FormatNumber(v, decimals) },
+	}).Parse(compareMarkdownTemplateString)
+	if err != nil {
+		return err
+	}
+
+	out := &bytes.Buffer{}
+	if err := tmpl.Execute(out, comparison); err != nil {
+		return err
+	}
+	return os.WriteFile(filename, out.Bytes(), 0o644)
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+func TestStatDirection(t *testing.T) {
+	tests := []struct {
+		metric     string
+		metricType string
+		stat       string
+		want       int
+	}{
+		{"http_req_duration", "trend", "p(95)", -1},
+		{"http_req_duration{status:200}", "trend", "avg", -1},
+		{"http_req_duration", "trend", "count", 0},
+		{"http_req_failed", "rate", "rate", -1},
+		{"http_req_failed", "rate", "passes", 0},
+		{"checks", "rate", "rate", 1},
+		{"http_reqs", "counter", "rate", 1},
+		{"dropped_iterations", "counter", "count", -1},
+		{"grpc_reqs", "counter", "rate", 0},
+		{"grpc_reqs", "counter", "count", 0},
+		{"vus", "gauge", "value", 0},
+	}
+	for _, test := range tests {
+		t.Run(test.metric+" "+test.stat, func(t *testing.T) {
+			if got := statDirection(test.metric, test.metricType, test.stat); got != test.want {
+				t.Errorf("got %d, want %d", got, test.want)
+			}
+		})
+	}
+}
+
+func TestRelativeChange(t *testing.T) {
+	tests := []struct {
+		name      string
+		baseline  float64
+		candidate float64
+		points    bool
+		want      float64
+	}{
+		{"increase", 400, 440, false, 10},
+		{"decrease", 400, 300, false, -25},
+		{"negative baseline", -200, -100, false, 50},
+		{"rate in points", 0.01, 0.025, true, 1.5},
+		{"pass rate drop in points", 0.99, 0.95, true, -4},
+		{"rate from zero in points", 0, 0.5, true, 50},
+		{"up from zero", 0, 50, false, 100},
+		{"down from zero", 0, -3, false, -100},
+		{"zero to zero", 0, 0, false, 0},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := relativeChange(test.baseline, test.candidate, test.points); math.Abs(got-test.want) > 1e-9 {
+				t.Errorf("got %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestToleranceVerdict(t *testing.T) {
+	tolerance := Tolerance{Warn: 2, Fail: 10}
+
+	tests := []struct {
+		name      string
+		direction int
+		change    float64
+		want      string
+	}{
+		{"within warn", -1, 2, verdictUnchanged},
+		{"within warn the better way", -1, -1.5, verdictUnchanged},
+		{"lower is better", -1, -5, verdictImproved},
+		{"higher is better", 1, 20, verdictImproved},
+		{"worse within fail", -1, 5, verdictWarning},
+		{"worse at fail", -1, 10, verdictWarning},
+		{"worse past fail", -1, 10.5, verdictRegressed},
+		{"lower past fail", 1, -12, verdictRegressed},
+		{"no direction", 0, 50, verdictChanged},
+		{"no direction within warn", 0, -1, verdictUnchanged},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := tolerance.verdict(test.direction, test.change); got != test.want {
+				t.Errorf("got %s, want %s", got, test.want)
+			}
+		})
+	}
+}
+
+func TestCompareCounts(t *testing.T) {
+	tolerance := Tolerance{Warn: 1, Fail: 3}
+
+	tests := []struct {
+		name       string
+		basePasses int
+		baseFails  int
+		inBase     bool
+		candPasses int
+		candFails  int
+		inCand     bool
+		change     float64
+		want       string
+	}{
+		{"same pass rate", 99, 1, true, 198, 2, true, 0, verdictUnchanged},
+		{"drop in points", 99, 1, true, 95, 5, true, -4, verdictRegressed},
+		{"small drop", 99, 1, true, 97, 3, true, -2, verdictWarning},
+		{"rise", 90, 10, true, 100, 0, true, 10, verdictImproved},
+		{"added", 0, 0, false, 10, 0, true, 0, verdictAdded},
+		{"removed", 10, 0, true, 0, 0, false, 0, verdictRemoved},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			diff := compareCounts(tolerance, test.basePasses, test.baseFails, test.inBase, test.candPasses, test.candFails, test.inCand)
+			if math.Abs(diff.Change-test.change) > 1e-9 || diff.Verdict != test.want {
+				t.Errorf("got %v %s, want %v %s", diff.Change, diff.Verdict, test.change, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Decoding of the CSV written by `k6 run --out csv=results.csv`
+// The first three columns are fixed, followed by a column per system tag, then extra_tags & metadata
+//  metric_name,timestamp,metric_value,check,error,error_code,expected_response,group,method,name,proto,scenario,...,extra_tags,metadata
+//  http_reqs,1641298536,1.000000,,,,true,,GET,http://test.k6.io,HTTP/1.1,default,...,,
+// The CSV doesn't say what type each metric is, so built-in metrics are known and the rest are
+// taken to be trends, unless declared otherwise with -metrictypes
+
+// Columns which aren't tags
+const (
+	csvMetricName  = "metric_name"
+	csvTimestamp   = "timestamp"
+	csvMetricValue = "metric_value"
+	csvExtraTags   = "extra_tags"
+	csvMetadata    = "metadata"
+)
+
+// readCSV feeds every row of a K6 CSV output file into the aggregator
+func readCSV(r io.Reader, agg *aggregator) error {
+	reader := csv.NewReader(r)
+	reader.ReuseRecord = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return &DecodeError{Path: "line 1", Err: err}
+	}
+	header = append([]string{}, header...)
+	columns := map[string]int{}
+	for i, name := range header {
+		columns[name] = i
+	}
+	for _, name := range []string{csvMetricName, csvTimestamp, csvMetricValue} {
+		if _, ok := columns[name]; !ok {
+			return &DecodeError{Path: "line 1", Err: fmt.Errorf("missing %q column, is this K6 CSV output?", name)}
+		}
+	}
+
+	for line := 2; ; line++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return &DecodeError{Path: fmt.Sprintf("line %d", line), Err: err}
+		}
+
+		s := sample{Metric: record[columns[csvMetricName]], Tags: map[string]string{}}
+		if s.Metric == "" {
+			return &DecodeError{Path: fmt.Sprintf("line %d: %s", line, csvMetricName), Err: errors.New("missing metric name")}
+		}
+		if s.Time, err = parseCSVTimestamp(record[columns[csvTimestamp]]); err != nil {
+			return &DecodeError{Path: fmt.Sprintf("line %d: %s", line, csvTimestamp), Err: err}
+		}
+		if s.Value, err = strconv.ParseFloat(record[columns[csvMetricValue]], 64); err != nil {
+			return &DecodeError{Path: fmt.Sprintf("line %d: %s", line, csvMetricValue), Err: err}
+		}
+
+		for i, name := range header {
+			if i >= len(record) || record[i] == "" {
+				continue
+			}
+			switch name {
+			case csvMetricName, csvTimestamp, csvMetricValue, csvMetadata:
+			case csvExtraTags:
+				for _, pair := range strings.Split(record[i], "&") {
+					if j := strings.Index(pair, "="); j > 0 {
+						s.Tags[pair[:j]] = pair[j+1:]
+					}
+				}
+			default:
+				s.Tags[name] = record[i]
+			}
+		}
+
+		if err := agg.addSample(s); err != nil {
+			return &DecodeError{Path: fmt.Sprintf("line %d", line), Err: err}
+		}
+	}
+}
+
+// parseCSVTimestamp handles all of K6's CSV timeFormat options
+// Unix timestamps can be in seconds (the default), milli, micro or nano seconds, told apart by size
+func parseCSVTimestamp(value string) (time.Time, error) {
+	if unix, err := strconv.ParseInt(value, 10, 64); err == nil {
+		switch {
+		case unix < 1e11:
+			return time.Unix(unix, 0), nil
+		case unix < 1e14:
+			return time.Unix(0, unix*int64(time.Millisecond)), nil
+		case unix < 1e17:
+			return time.Unix(0, unix*int64(time.Microsecond)), nil
+		default:
+			return time.Unix(0, unix), nil
+		}
+	}
+
+	return time.Parse(time.RFC3339Nano, value)
+}
+
+// parseMetricTypes parses a list of metric type declarations, e.g. "grpc_reqs=counter,queue=gauge:time"
+func parseMetricTypes(list string) ([]metricDefinition, error) {
+	defs := []metricDefinition{}
+	for _, decl := range strings.Split(list, ",") {
+		decl = strings.TrimSpace(decl)
+		if decl == "" {
+			continue
+		}
+		i := strings.Index(decl, "=")
+		if i <= 0 {
+			return nil, fmt.Errorf("invalid metric type %q, expected name=type", decl)
+		}
+
+		def := metricDefinition{Name: decl[:i], Type: decl[i+1:], Contains: "default"}
+		if j := strings.Index(def.Type, ":"); j >= 0 {
+			def.Type, def.Contains = def.Type[:j], def.Type[j+1:]
+		}
+		switch def.Type {
+		case "counter", "gauge", "rate", "trend":
+		default:
+			return nil, fmt.Errorf("invalid metric type %q, expected counter, gauge, rate or trend", decl)
+		}
+		switch def.Contains {
+		case "default", "time", "data":
+		default:
+			return nil, fmt.Errorf("invalid metric type %q, value kind must be default, time or data", decl)
+		}
+		defs = append(defs, def)
+	}
+	return defs, nil
+}
+
+// isCSV checks if the first line of a file looks like a K6 CSV header
+func isCSV(firstLine []byte) bool {
+	return strings.HasPrefix(strings.TrimSpace(string(firstLine)), csvMetricName+","+csvTimestamp+",")
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+const csvResults = `metric_name,timestamp,metric_value,check,error,error_code,expected_response,group,method,name,proto,scenario,service,status,subproto,tls_version,url,extra_tags,metadata
+http_req_duration,1610107200,10.000000,,,,true,::kasir,GET,http://test.k6.io,HTTP/1.1,default,,200,,,http://test.k6.io,region=eu&tier=,
+http_req_duration,1610107205,30.000000,,,,true,::kasir,GET,http://test.k6.io,HTTP/1.1,default,,200,,,http://test.k6.io,,
+checks,1610107205,1.000000,status is 200,,,,::kasir,,,,default,,,,,,,
+checks,1610107206,0.000000,status is 200,,,,::kasir,,,,default,,,,,,,
+queue_depth,1610107210,4.000000,,,,,,,,,default,,,,,,,
+`
+
+func TestReadCSV(t *testing.T) {
+	opts := inputOptions{
+		Format:      formatAuto,
+		TrendStats:  []string{"avg", "max"},
+		MetricTypes: []metricDefinition{{Name: "queue_depth", Type: "gauge", Contains: "default"}},
+		Submetrics:  []string{"http_req_duration{region:eu}"},
+	}
+	resultData, format, err := loadResults(strings.NewReader(csvResults), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(format, "CSV") {
+		t.Errorf("got format %s, want CSV", format)
+	}
+	if resultData.State.TestRunDurationMs != 10000 {
+		t.Errorf("got duration %gms, want 10000ms", resultData.State.TestRunDurationMs)
+	}
+
+	if duration := resultData.Metrics["http_req_duration"]; duration.Type != "trend" || duration.Values["avg"] != 20 {
+		t.Errorf("got http_req_duration %+v", duration)
+	}
+	// Extra tags are split into tags of their own, empty ones are dropped
+	if region := resultData.Metrics["http_req_duration{region:eu}"]; region.Values["max"] != 10 {
+		t.Errorf("got submetric %+v, want the sample with the extra tag", region)
+	}
+	if queue := resultData.Metrics["queue_depth"]; queue.Type != "gauge" || queue.Values["value"] != 4 {
+		t.Errorf("got queue_depth %+v, want a declared gauge", queue)
+	}
+
+	groups := resultData.RootGroup.Groups
+	if len(groups) != 1 || len(groups[0].Checks) != 1 {
+		t.Fatalf("got groups %+v", groups)
+	}
+	if check := groups[0].Checks[0]; check.Name != "status is 200" || check.Passes != 1 || check.Fails != 1 {
+		t.Errorf("got check %+v", check)
+	}
+
+	reader := bufio.NewReaderSize(strings.NewReader(csvResults), peekSize)
+	if got, err := detectFormat(reader); err != nil || got != formatCSV {
+		t.Errorf("got format %s %v, want %s", got, err, formatCSV)
+	}
+}
+
+func TestReadCSVErrors(t *testing.T) {
+	header := "metric_name,timestamp,metric_value,group\n"
+	tests := []struct {
+		name  string
+		input string
+		path  string
+	}{
+		{"empty", "", "line 1"},
+		{"missing column", "metric_name,metric_value\nvus,1\n", "line 1"},
+		{"missing metric name", header + ",1610107200,1,\n", "line 2: metric_name"},
+		{"bad timestamp", header + "vus,1610107200,1,\nvus,yesterday,1,\n", "line 3: timestamp"},
+		{"bad value", header + "vus,1610107200,one,\n", "line 2: metric_value"},
+		{"wrong field count", header + "vus,1610107200,1\n", "line 2"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := readCSV(strings.NewReader(test.input), newAggregator(nil))
+			var decodeErr *DecodeError
+			if !errors.As(err, &decodeErr) {
+				t.Fatalf("got %v, want a DecodeError", err)
+			}
+			if decodeErr.Path != test.path {
+				t.Errorf("got path %s, want %s", decodeErr.Path, test.path)
+			}
+		})
+	}
+}
+
+func TestParseCSVTimestamp(t *testing.T) {
+	want := time.Date(2021, 1, 8, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		value string
+		want  time.Time
+	}{
+		{"1610107200", want},
+		{"1610107200123", want.Add(123 * time.Millisecond)},
+		{"1610107200123456", want.Add(123456 * time.Microsecond)},
+		{"1610107200123456789", want.Add(123456789)},
+		{"2021-01-08T12:00:00Z", want},
+		{"2021-01-08T13:00:00.5+01:00", want.Add(500 * time.Millisecond)},
+	}
+	for _, test := range tests {
+		got, err := parseCSVTimestamp(test.value)
+		if err != nil {
+			t.Errorf("%s: %v", test.value, err)
+			continue
+		}
+		if !got.Equal(test.want) {
+			t.Errorf("%s: got %s, want %s", test.value, got.UTC(), test.want)
+		}
+	}
+
+	if _, err := parseCSVTimestamp("08/01/2021"); err == nil {
+		t.Error("got no error for a timestamp in an unknown format")
+	}
+}
+
+func TestParseMetricTypes(t *testing.T) {
+	defs, err := parseMetricTypes(" grpc_reqs=counter, queue=gauge:time,,payload=trend:data")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []metricDefinition{
+		{Name: "grpc_reqs", Type: "counter", Contains: "default"},
+		{Name: "queue", Type: "gauge", Contains: "time"},
+		{Name: "payload", Type: "trend", Contains: "data"},
+	}
+	if len(defs) != len(want) {
+		t.Fatalf("got %+v, want %+v", defs, want)
+	}
+	for i := range want {
+		if defs[i].Name != want[i].Name || defs[i].Type != want[i].Type || defs[i].Contains != want[i].Contains {
+			t.Errorf("got %+v, want %+v", defs[i], want[i])
+		}
+	}
+
+	for _, list := range []string{"queue", "=gauge", "queue=histogram", "queue=gauge:bytes"} {
+		if _, err := parseMetricTypes(list); err == nil {
+			t.Errorf("%s: got no error", list)
+		}
+	}
+}
@@ -0,0 +1,553 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"time"
+)
+
+// Raw sample inputs of soak tests are analysed for drift, latency creeping up, errors piling up or throughput decaying over hours
+//  1. The steady part of the test, from when the VUs or iterations started per second first reached 90% of their highest to when
+//     they last were, is cut into equal windows of whole minutes
+//  2. A least squares line is fitted through the P95, error rate & throughput of the windows, of all requests & of each endpoint
+//  3. A slope is significant when a t-test on it gives p < 0.05, degradation is a significant slope the worse way that changed
+//     the fitted value enough to matter
+// The first & last hour of the steady part are compared too, or the first & last quarter when it's shorter than 4 hours
+
+// Fraction of the highest load that counts as the steady part of the test
+const steadyLoad = 0.9
+
+// Shortest steady part worth analysing, drift needs time to show
+const minDriftDuration = 30 * time.Minute
+
+// Most windows the steady part is cut into, a bigger window is used for long tests
+const maxDriftWindows = 60
+
+// Fewest windows a line is fitted through
+const minDriftWindows = 6
+
+// Longest period at the start & end that are compared
+const driftPeriod = time.Hour
+
+// P-value under which a slope is significant
+const driftSignificance = 0.05
+
+// Smallest change of the fitted latency or throughput over the steady part that's degradation, as a fraction of where it started
+const minDriftChange = 0.05
+
+// Smallest change of the fitted error rate over the steady part that's degradation, 0.1 percentage points
+const minErrorDrift = 0.001
+
+// Relative accuracy of the P95 of windows & periods, their durations are counted in buckets rather than kept, so the
+// drift analysis doesn't hold another copy of every duration, the metric, timeline & endpoint stats still keep every
+// duration to report exact percentiles, so memory still grows with the length of the test
+const sketchAccuracy = 0.01
+
+// Drift is how requests changed over the steady part of a test
+type Drift struct {
+	StartTime time.Time // Steady part of the test that was analysed
+	EndTime   time.Time
+	WindowMs  float64 // Size of each window
+	PeriodMs  float64 // Length of the first & last periods compared
+	Degraded  int     // Endpoints with a trend that degraded
+	Overall   DriftTrend
+	Endpoints []DriftTrend // Endpoints with requests in enough windows, the degraded first then sorted by name
+}
+
+// DriftTrend is how the requests of the whole test or one endpoint changed
+type DriftTrend struct {
+	Method     string // Empty for all requests
+	Name       string
+	Windows    []DriftWindow
+	Latency    DriftFit // Of the P95 of http_req_duration in each window
+	ErrorRate  DriftFit // Of http_req_failed
+	Throughput DriftFit // Of http_reqs per second
+	First      DriftPeriod
+	Last       DriftPeriod
+	Degraded   bool // Any of the fits degraded
+}
+
+// DriftWindow is the requests in one window of the steady part
+type DriftWindow struct {
+	Time      time.Time
+	Requests  float64
+	RPS       float64
+	P95       float64 // Only known when there were requests
+	ErrorRate float64 // Only known when HasErrors
+	HasErrors bool
+}
+
+// DriftPeriod is the requests of the first or last period of the steady part
+type DriftPeriod struct {
+	Requests  float64
+	RPS       float64
+	P95       float64
+	ErrorRate float64
+	HasErrors bool
+}
+
+// DriftFit is a line fitted through the windows, with how likely its slope is to be chance
+type DriftFit struct {
+	Known       bool    // Fitted from at least minDriftWindows windows
+	Start       float64 // Fitted value at the start & end of the steady part
+	End         float64
+	Slope       float64 // Change per hour
+	PValue      float64 // Chance of a slope at least this steep if there was no trend, from a two tailed t-test
+	Significant bool
+	Degraded    bool // Significant & enough the worse way, latency or errors going up, throughput going down
+}
+
+// driftRecorder collects the requests of each endpoint by the minute, keyed by method & name the same as endpoints
+type driftRecorder struct {
+	endpoints *endpointRecorder // For the names of endpoints, normalised the same way
+	sinks     map[string]*driftSink
+}
+
+type driftSink struct {
+	method  string
+	name    string
+	minutes map[int64]*driftSlot // Keyed by unix minute
+}
+
+type driftSlot struct {
+	requests      float64
+	failed        float64
+	failedSamples float64
+	durations     durationSketch
+}
+
+func newDriftRecorder(endpoints *endpointRecorder) *driftRecorder {
+	return &driftRecorder{endpoints: endpoints, sinks: map[string]*driftSink{}}
+}
+
+// add records a sample, if it's an HTTP request metric
+func (r *driftRecorder) add(s sample) {
+	switch s.Metric {
+	case "http_reqs", "http_req_duration", "http_req_failed":
+	default:
+		return
+	}
+	method, name, _ := r.endpoints.name(s)
+	if name == "" {
+		return
+	}
+
+	key := method + " " + name
+	sink, ok := r.sinks[key]
+	if !ok {
+		sink = &driftSink{method: method, name: name, minutes: map[int64]*driftSlot{}}
+		r.sinks[key] = sink
+	}
+	minute := s.Time.Unix() / 60
+	slot, ok := sink.minutes[minute]
+	if !ok {
+		slot = &driftSlot{}
+		sink.minutes[minute] = slot
+	}
+
+	switch s.Metric {
+	case "http_reqs":
+		slot.requests += s.Value
+	case "http_req_duration":
+		slot.durations.add(s.Value)
+	case "http_req_failed":
+		slot.failedSamples++
+		if s.Value != 0 {
+			slot.failed++
+		}
+	}
+}
+
+// result analyses the steady part of the test, nil when it's too short
+func (r *driftRecorder) result(timeline *Timeline) *Drift {
+	first, last, ok := steadyMinutes(timeline)
+	if !ok || time.Duration(last-first)*time.Minute < minDriftDuration || len(r.sinks) == 0 {
+		return nil
+	}
+	length := last - first
+	step := int64(time.Hour / time.Minute)
+	for _, size := range timelineBucketSizes {
+		if minutes := int64(size / time.Minute); minutes >= 1 && length <= minutes*maxDriftWindows {
+			step = minutes
+			break
+		}
+	}
+	period := int64(driftPeriod / time.Minute)
+	if length < 4*period {
+		period = length / 4
+	}
+
+	a := driftAnalysis{first: first, last: last, step: step, period: period}
+	drift := &Drift{
+		StartTime: time.Unix(first*60, 0).UTC(),
+		EndTime:   time.Unix(last*60, 0).UTC(),
+		WindowMs:  float64(step * 60000),
+		PeriodMs:  float64(period * 60000),
+	}
+
+	all := map[int64]*driftSlot{}
+	for _, sink := range r.sinks {
+		for minute, slot := range sink.minutes {
+			merged, ok := all[minute]
+			if !ok {
+				merged = &driftSlot{}
+				all[minute] = merged
+			}
+			merged.requests += slot.requests
+			merged.failed += slot.failed
+			merged.failedSamples += slot.failedSamples
+			merged.durations.merge(slot.durations)
+		}
+		if trend, ok := a.trend(sink.minutes); ok {
+			trend.Method, trend.Name = sink.method, sink.name
+			drift.Endpoints = append(drift.Endpoints, trend)
+			if trend.Degraded {
+				drift.Degraded++
+			}
+		}
+	}
+	drift.Overall, ok = a.trend(all)
+	if !ok {
+		return nil
+	}
+
+	sort.Slice(drift.Endpoints, func(i, j int) bool {
+		ei, ej := drift.Endpoints[i], drift.Endpoints[j]
+		if ei.Degraded != ej.Degraded {
+			return ei.Degraded
+		}
+		if ei.Name != ej.Name {
+			return ei.Name < ej.Name
+		}
+		return ei.Method < ej.Method
+	})
+	return drift
+}
+
+// steadyMinutes finds the steady part of a timeline in whole unix minutes, from the first to the last bucket with
+// the VUs or the iterations started per second at steadyLoad of their highest, either can stay level while the other moves,
+// e.g. VUs stay level while throughput decays, and arrival rate executors start more VUs as requests slow down
+func steadyMinutes(timeline *Timeline) (first, last int64, ok bool) {
+	if timeline == nil || len(timeline.Buckets) == 0 {
+		return 0, 0, false
+	}
+	rate := func(b TimelineBucket) float64 { return (b.Iterations + b.Dropped) / timeline.bucketSeconds(b) }
+	maxVUs, maxRate := 0.0, 0.0
+	for _, bucket := range timeline.Buckets {
+		if bucket.Requests > 0 {
+			maxVUs, maxRate = math.Max(maxVUs, bucket.VUs), math.Max(maxRate, rate(bucket))
+		}
+	}
+
+	start, end := -1, -1
+	for i, bucket := range timeline.Buckets {
+		steady := (maxVUs > 0 && bucket.VUs >= steadyLoad*maxVUs) || (maxRate > 0 && rate(bucket) >= steadyLoad*maxRate)
+		if bucket.Requests > 0 && steady {
+			if start < 0 {
+				start = i
+			}
+			end = i
+		}
+	}
+	if start < 0 {
+		return 0, 0, false
+	}
+	// Only whole minutes, so a minute partly in the ramp up or down isn't counted
+	first = (timeline.Buckets[start].Time.Unix() + 59) / 60
+	last = (timeline.Buckets[end].Time.Unix() + int64(timeline.bucketSeconds(timeline.Buckets[end]))) / 60
+	return first, last, last > first
+}
+
+// driftAnalysis is how the steady part is cut up, in unix minutes
+type driftAnalysis struct {
+	first  int64
+	last   int64
+	step   int64 // Minutes in each window
+	period int64 // Minutes in the first & last periods
+}
+
+// trend fits lines through the windows of a set of minutes, not ok when there were requests in too few windows
+func (a driftAnalysis) trend(minutes map[int64]*driftSlot) (DriftTrend, bool) {
+	trend := DriftTrend{}
+	hours := float64(a.last-a.first) / 60
+	latency, errorRate, throughput := driftPoints{}, driftPoints{}, driftPoints{}
+	for from := a.first; from < a.last; from += a.step {
+		to := from + a.step
+		if to > a.last {
+			to = a.last
+		}
+		period := a.total(minutes, from, to)
+		window := DriftWindow{
+			Time:      time.Unix(from*60, 0).UTC(),
+			Requests:  period.Requests,
+			RPS:       period.RPS,
+			P95:       period.P95,
+			ErrorRate: period.ErrorRate,
+			HasErrors: period.HasErrors,
+		}
+		trend.Windows = append(trend.Windows, window)
+
+		x := (float64(from+to)/2 - float64(a.first)) / 60
+		throughput.add(x, window.RPS)
+		if window.Requests > 0 {
+			latency.add(x, window.P95)
+		}
+		if window.HasErrors {
+			errorRate.add(x, window.ErrorRate)
+		}
+	}
+	if len(latency.xs) < minDriftWindows {
+		return trend, false
+	}
+
+	trend.Latency = latency.fit(hours, func(f DriftFit) bool { return f.End-f.Start >= minDriftChange*f.Start })
+	trend.ErrorRate = errorRate.fit(hours, func(f DriftFit) bool { return f.End-f.Start >= minErrorDrift })
+	trend.Throughput = throughput.fit(hours, func(f DriftFit) bool { return f.Start-f.End >= minDriftChange*f.Start })
+	trend.First = a.total(minutes, a.first, a.first+a.period)
+	trend.Last = a.total(minutes, a.last-a.period, a.last)
+	trend.Degraded = trend.Latency.Degraded || trend.ErrorRate.Degraded || trend.Throughput.Degraded
+	return trend, true
+}
+
+// total is the requests of the minutes from one minute up to another
+func (a driftAnalysis) total(minutes map[int64]*driftSlot, from, to int64) DriftPeriod {
+	period := DriftPeriod{}
+	failed, failedSamples := 0.0, 0.0
+	durations := durationSketch{}
+	for minute := from; minute < to; minute++ {
+		if slot, ok := minutes[minute]; ok {
+			period.Requests += slot.requests
+			failed += slot.failed
+			failedSamples += slot.failedSamples
+			durations.merge(slot.durations)
+		}
+	}
+	period.RPS = perSecond(period.Requests, time.Duration(to-from)*time.Minute)
+	period.P95 = durations.percentile(0.95)
+	if failedSamples > 0 {
+		period.ErrorRate, period.HasErrors = failed/failedSamples, true
+	}
+	return period
+}
+
+// durationSketch counts durations in buckets growing exponentially in size, the same as DDSketch, so a percentile
+// from it is within sketchAccuracy of the real value, and there can only ever be about a thousand buckets
+type durationSketch struct {
+	counts map[int]float64 // Keyed by bucket index, bucket i holds durations from gamma^(i-1) up to gamma^i
+	zero   float64         // Durations of 0, which have no bucket
+	count  float64
+}
+
+// Growth of each bucket over the last
+var sketchGamma = (1 + sketchAccuracy) / (1 - sketchAccuracy)
+
+func (d *durationSketch) add(duration float64) {
+	d.count++
+	if duration <= 0 {
+		d.zero++
+		return
+	}
+	if d.counts == nil {
+		d.counts = map[int]float64{}
+	}
+	d.counts[int(math.Ceil(math.Log(duration)/math.Log(sketchGamma)))]++
+}
+
+func (d *durationSketch) merge(other durationSketch) {
+	if other.count == 0 {
+		return
+	}
+	if d.counts == nil {
+		d.counts = map[int]float64{}
+	}
+	for i, count := range other.counts {
+		d.counts[i] += count
+	}
+	d.zero += other.zero
+	d.count += other.count
+}
+
+// percentile finds the bucket holding a percentile, as a fraction, and gives the value in it with the least relative error
+func (d *durationSketch) percentile(pct float64) float64 {
+	rank := pct * (d.count - 1)
+	if d.count == 0 || rank < d.zero {
+		return 0
+	}
+	indexes := make([]int, 0, len(d.counts))
+	for i := range d.counts {
+		indexes = append(indexes, i)
+	}
+	sort.Ints(indexes)
+	seen := d.zero
+	for _, i := range indexes {
+		seen += d.counts[i]
+		if seen > rank {
+			return 2 * math.Pow(sketchGamma, float64(i)) / (sketchGamma + 1)
+		}
+	}
+	return 2 * math.Pow(sketchGamma, float64(indexes[len(indexes)-1])) / (sketchGamma + 1)
+}
+
+// driftPoints are the values of the windows, x in hours from the start of the steady part
+type driftPoints struct {
+	xs []float64
+	ys []float64
+}
+
+func (p *driftPoints) add(x, y float64) {
+	p.xs, p.ys = append(p.xs, x), append(p.ys, y)
+}
+
+// fit is the least squares line through the points, worse checks if the fitted change is enough the worse way to be degradation
+func (p driftPoints) fit(hours float64, worse func(DriftFit) bool) DriftFit {
+	n := float64(len(p.xs))
+	if n < minDriftWindows {
+		return DriftFit{}
+	}
+	meanX, meanY := 0.0, 0.0
+	for i := range p.xs {
+		meanX += p.xs[i] / n
+		meanY += p.ys[i] / n
+	}
+	sxx, sxy := 0.0, 0.0
+	for i := range p.xs {
+		dx := p.xs[i] - meanX
+		sxx += dx * dx
+		sxy += dx * (p.ys[i] - meanY)
+	}
+	if sxx == 0 {
+		return DriftFit{}
+	}
+	slope := sxy / sxx
+	intercept := meanY - slope*meanX
+	residuals := 0.0
+	for i := range p.xs {
+		residual := p.ys[i] - (intercept + slope*p.xs[i])
+		residuals += residual * residual
+	}
+
+	fit := DriftFit{Known: true, Start: intercept, End: intercept + slope*hours, Slope: slope, PValue: 1}
+	// A perfect fit has no standard error, any slope at all is certain
+	if standardError := math.Sqrt(residuals / (n - 2) / sxx); standardError > 0 {
+		fit.PValue = studentTwoTailed(slope/standardError, n-2)
+	} else if slope != 0 {
+		fit.PValue = 0
+	}
+	fit.Significant = fit.PValue < driftSignificance
+	fit.Degraded = fit.Significant && worse(fit)
+	return fit
+}
+
+// studentTwoTailed is the two tailed p-value of a t statistic, with the given degrees of freedom
+func studentTwoTailed(t, df float64) float64 {
+	return regularizedBeta(df/(df+t*t), df/2, 0.5)
+}
+
+// regularizedBeta is the regularized incomplete beta function I_x(a, b), from its continued fraction
+func regularizedBeta(x, a, b float64) float64 {
+	switch {
+	case x <= 0:
+		return 0
+	case x >= 1:
+		return 1
+	case x > (a+1)/(a+b+2):
+		// The continued fraction converges quickly only below this, above it use the symmetry of the function
+		return 1 - regularizedBeta(1-x, b, a)
+	}
+	lnA, _ := math.Lgamma(a)
+	lnB, _ := math.Lgamma(b)
+	lnAB, _ := math.Lgamma(a + b)
+	front := math.Exp(lnAB - lnA - lnB + a*math.Log(x) + b*math.Log(1-x))
+	return front * betaFraction(x, a, b) / a
+}
+
+// betaFraction evaluates the continued fraction of the incomplete beta function, with Lentz's method
+func betaFraction(x, a, b float64) float64 {
+	const tiny, epsilon = 1e-300, 1e-14
+	clamp := func(v float64) float64 {
+		if math.Abs(v) < tiny {
+			return tiny
+		}
+		return v
+	}
+	c, d := 1.0, 1/clamp(1-(a+b)*x/(a+1))
+	result := d
+	for m := 1.0; m <= 300; m++ {
+		even := m * (b - m) * x / ((a + 2*m - 1) * (a + 2*m))
+		d, c = 1/clamp(1+even*d), clamp(1+even/c)
+		result *= d * c
+
+		odd := -(a + m) * (a + b + m) * x / ((a + 2*m) * (a + 2*m + 1))
+		d, c = 1/clamp(1+odd*d), clamp(1+odd/c)
+		delta := d * c
+		result *= delta
+		if math.Abs(delta-1) < epsilon {
+			break
+		}
+	}
+	return result
+}
+
+// driftCharts draws the P95, error rate & throughput of all requests over the steady part with their fitted lines,
+// and the P95 of every degraded endpoint
+func driftCharts(locale *Locale, drift *Drift) []Chart {
+	if drift == nil {
+		return nil
+	}
+	elapsed := func(x float64) string {
+		return fmt.Sprint(time.Duration(x * float64(time.Second)).Round(time.Second))
+	}
+	milliseconds := func(v float64) string { return formatMs(locale, v) }
+	percentage := func(v float64) string { return locale.FormatNumber(v*100, 2) + "%" }
+	perSecond := func(v float64) string { return locale.FormatNumber(v, 1) + "/s" }
+	windowSeconds := drift.WindowMs / 1000
+	lengthSeconds := drift.EndTime.Sub(drift.StartTime).Seconds()
+
+	series := func(name string, trend DriftTrend, format func(float64) string, value func(DriftWindow) (float64, bool)) chartSeries {
+		s := chartSeries{Name: name}
+		for _, window := range trend.Windows {
+			if y, ok := value(window); ok {
+				// Windows are plotted at their middle, the same x the line was fitted at
+				x := math.Min(window.Time.Sub(drift.StartTime).Seconds()+windowSeconds/2, lengthSeconds)
+				s.Points = append(s.Points, chartPoint{X: x, Y: y, Label: elapsed(x) + ": " + format(y)})
+			}
+		}
+		return s
+	}
+	fitted := func(fit DriftFit, format func(float64) string) []chartSeries {
+		if !fit.Known {
+			return nil
+		}
+		name := locale.T("trend")
+		return []chartSeries{{Name: name, Points: []chartPoint{
+			{X: 0, Y: fit.Start, Label: name + ": " + format(fit.Start)},
+			{X: lengthSeconds, Y: fit.End, Label: name + ": " + format(fit.End)},
+		}}}
+	}
+
+	charts := []Chart{}
+	add := func(title string, format func(float64) string, lines []chartSeries) {
+		if len(lines) > 0 && len(lines[0].Points) > 0 {
+			charts = append(charts, Chart{Title: title, SVG: lineChart(title, lines, format, elapsed)})
+		}
+	}
+
+	overall := drift.Overall
+	latency := series(statLabel(locale, "p(95)"), overall, milliseconds, func(w DriftWindow) (float64, bool) { return w.P95, w.Requests > 0 })
+	add(locale.T("latencyDrift"), milliseconds, append([]chartSeries{latency}, fitted(overall.Latency, milliseconds)...))
+	errors := series(locale.T("http_req_failed"), overall, percentage, func(w DriftWindow) (float64, bool) { return w.ErrorRate, w.HasErrors })
+	add(locale.T("errorRateDrift"), percentage, append([]chartSeries{errors}, fitted(overall.ErrorRate, percentage)...))
+	throughput := series(locale.T("http_reqs"), overall, perSecond, func(w DriftWindow) (float64, bool) { return w.RPS, true })
+	add(locale.T("throughputDrift"), perSecond, append([]chartSeries{throughput}, fitted(overall.Throughput, perSecond)...))
+
+	endpoints := []chartSeries{}
+	for _, trend := range drift.Endpoints {
+		if trend.Degraded {
+			name := trend.Method + " " + trend.Name
+			endpoints = append(endpoints, series(name, trend, milliseconds, func(w DriftWindow) (float64, bool) { return w.P95, w.Requests > 0 }))
+		}
+	}
+	add(locale.T("degradedEndpointsP95"), milliseconds, endpoints)
+	return charts
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"math"
+	"math/rand"
+	"sort"
+	"testing"
+	"time"
+)
+
+func TestDurationSketchPercentile(t *testing.T) {
+	random := rand.New(rand.NewSource(1))
+	values := []float64{}
+	first, second := durationSketch{}, durationSketch{}
+	for i := 0; i < 20000; i++ {
+		value := math.Exp(random.NormFloat64()) * 200
+		values = append(values, value)
+		if i%2 == 0 {
+			first.add(value)
+		} else {
+			second.add(value)
+		}
+	}
+	first.merge(second)
+	sort.Float64s(values)
+
+	for _, pct := range []float64{0.5, 0.9, 0.95, 0.99} {
+		want := sortedPercentile(values, pct)
+		if got := first.percentile(pct); math.Abs(got-want)/want > sketchAccuracy {
+			t.Errorf("p(%g) got %g, want %g within %g", pct*100, got, want, sketchAccuracy)
+		}
+	}
+	if got := (&durationSketch{}).percentile(0.95); got != 0 {
+		t.Errorf("empty sketch got %g, want 0", got)
+	}
+}
+
+func TestStudentTwoTailed(t *testing.T) {
+	// Critical values from t tables, & p-values of a t of 0 and of a Cauchy distribution with 1 degree of freedom
+	tests := []struct {
+		t, df, want float64
+	}{
+		{2.228, 10, 0.05},
+		{1.812, 10, 0.10},
+		{3.169, 10, 0.01},
+		{2.042, 30, 0.05},
+		{1.96, 100000, 0.05},
+		{-2.228, 10, 0.05},
+		{0, 10, 1},
+		{1, 1, 0.5},
+	}
+	for _, test := range tests {
+		if got := studentTwoTailed(test.t, test.df); math.Abs(got-test.want) > 0.0005 {
+			t.Errorf("t=%g df=%g got %.5f, want %g", test.t, test.df, got, test.want)
+		}
+	}
+}
+
+func TestDriftFit(t *testing.T) {
+	random := rand.New(rand.NewSource(1))
+	// Windows every 5 minutes over 4 hours
+	points := func(value func(x float64) float64) driftPoints {
+		p := driftPoints{}
+		for i := 0; i < 48; i++ {
+			x := (float64(i) + 0.5) / 12
+			p.add(x, value(x))
+		}
+		return p
+	}
+	rising := func(f DriftFit) bool { return f.End-f.Start >= minDriftChange*f.Start }
+	falling := func(f DriftFit) bool { return f.Start-f.End >= minDriftChange*f.Start }
+
+	tests := []struct {
+		name            string
+		points          driftPoints
+		worse           func(DriftFit) bool
+		wantSignificant bool
+		wantDegraded    bool
+	}{
+		{"flat", points(func(float64) float64 { return 100 }), rising, false, false},
+		{"flat with noise", points(func(float64) float64 { return 100 + random.NormFloat64()*5 }), rising, false, false},
+		{"rising latency", points(func(x float64) float64 { return 100 + 20*x + random.NormFloat64()*5 }), rising, true, true},
+		{"falling latency", points(func(x float64) float64 { return 200 - 20*x + random.NormFloat64()*5 }), rising, true, false},
+		{"rising too little to matter", points(func(x float64) float64 { return 100 + 0.5*x + random.NormFloat64()*0.1 }), rising, true, false},
+		{"decaying throughput", points(func(x float64) float64 { return 50 - 3*x + random.NormFloat64() }), falling, true, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			fit := test.points.fit(4, test.worse)
+			if !fit.Known {
+				t.Fatal("got no fit")
+			}
+			if fit.Significant != test.wantSignificant || fit.Degraded != test.wantDegraded {
+				t.Errorf("got significant %v & degraded %v (p=%g, slope %g), want %v & %v",
+					fit.Significant, fit.Degraded, fit.PValue, fit.Slope, test.wantSignificant, test.wantDegraded)
+			}
+		})
+	}
+
+	few := driftPoints{}
+	for i := 0; i < minDriftWindows-1; i++ {
+		few.add(float64(i), float64(i))
+	}
+	if fit := few.fit(1, rising); fit.Known {
+		t.Errorf("got a fit from %d windows, want none", minDriftWindows-1)
+	}
+}
+
+func TestDriftResult(t *testing.T) {
+	random := rand.New(rand.NewSource(1))
+	endpoints := newEndpointRecorder(nil)
+	recorder, timeline := newDriftRecorder(endpoints), newTimelineRecorder()
+	start := time.Date(2025, 1, 1, 1, 0, 0, 0, time.UTC)
+	add := func(s sample) {
+		recorder.add(s)
+		timeline.add(s)
+	}
+
+	// Two hours at 10 VUs, with orders slowing down & failing more as it goes, and items staying the same
+	for second := 0; second < 2*3600; second++ {
+		at, progress := start.Add(time.Duration(second)*time.Second), float64(second)/7200
+		add(sample{Metric: "vus", Time: at, Value: 10, Tags: map[string]string{}})
+		for _, request := range []struct {
+			name     string
+			duration float64
+			failed   bool
+		}{
+			{"items", 80 + random.NormFloat64()*10, random.Float64() < 0.002},
+			{"orders", 120 + 200*progress + random.NormFloat64()*20, random.Float64() < 0.001+0.03*progress},
+		} {
+			tags := map[string]string{"method": "GET", "name": request.name}
+			failed := 0.0
+			if request.failed {
+				failed = 1
+			}
+			add(sample{Metric: "http_reqs", Time: at, Value: 1, Tags: tags})
+			add(sample{Metric: "http_req_duration", Time: at, Value: request.duration, Tags: tags})
+			add(sample{Metric: "http_req_failed", Time: at, Value: failed, Tags: tags})
+		}
+	}
+
+	drift := recorder.result(timeline.timeline(0))
+	if drift == nil {
+		t.Fatal("got no drift")
+	}
+	if drift.PeriodMs != 30*60000 {
+		t.Errorf("got periods of %s, want a quarter of 2h", msDuration(drift.PeriodMs))
+	}
+	if !drift.Overall.Degraded || drift.Degraded != 1 || len(drift.Endpoints) != 2 {
+		t.Fatalf("got overall degraded %v & %d of %d endpoints degraded, want true & 1 of 2",
+			drift.Overall.Degraded, drift.Degraded, len(drift.Endpoints))
+	}
+	orders, items := drift.Endpoints[0], drift.Endpoints[1]
+	if orders.Name != "orders" || !orders.Latency.Degraded || !orders.ErrorRate.Degraded || orders.Throughput.Degraded {
+		t.Errorf("got orders %s degraded latency %v, errors %v & throughput %v, want true, true & false",
+			orders.Name, orders.Latency.Degraded, orders.ErrorRate.Degraded, orders.Throughput.Degraded)
+	}
+	if items.Degraded {
+		t.Errorf("got items degraded, latency p=%g, errors p=%g", items.Latency.PValue, items.ErrorRate.PValue)
+	}
+	if orders.Last.P95 <= orders.First.P95 {
+		t.Errorf("got orders P95 from %g to %g, want it to rise", orders.First.P95, orders.Last.P95)
+	}
+
+	// Less than minDriftDuration of steady load isn't analysed
+	shortRecorder, shortTimeline := newDriftRecorder(endpoints), newTimelineRecorder()
+	for second := 0; second < 20*60; second++ {
+		at := start.Add(time.Duration(second) * time.Second)
+		for _, s := range []sample{
+			{Metric: "vus", Time: at, Value: 10, Tags: map[string]string{}},
+			{Metric: "http_reqs", Time: at, Value: 1, Tags: map[string]string{"method": "GET", "name": "items"}},
+			{Metric: "http_req_duration", Time: at, Value: 100, Tags: map[string]string{"method": "GET", "name": "items"}},
+		} {
+			shortRecorder.add(s)
+			shortTimeline.add(s)
+		}
+	}
+	if got := shortRecorder.result(shortTimeline.timeline(0)); got != nil {
+		t.Errorf("got drift of %s of steady load, want none", got.EndTime.Sub(got.StartTime))
+	}
+}
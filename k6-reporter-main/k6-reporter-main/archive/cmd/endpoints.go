@@ -0,0 +1,138 @@
+package main
+
+import (
+	"sort"
+	"time"
+)
+
+// Raw sample inputs are also broken down by endpoint, using the method & name tags K6 puts on every HTTP sample
+// The name tag is the URL, unless the script named the request e.g. http.get(url, {tags: {name: 'grouping route'}})
+// URLs are normalised with the URL rules first, so each row can be many raw URLs
+
+// Endpoint is the requests made to one endpoint
+type Endpoint struct {
+	Method    string
+	Name      string  // The name tag, or the normalised URL when the name is the URL
+	URLs      int     // Distinct raw URLs folded into this endpoint
+	Requests  float64 // http_reqs
+	RPS       float64
+	Failed    float64 // Failed http_req_failed samples, out of FailedSamples
+	ErrorRate float64 // Only known when there are http_req_failed samples
+	HasErrors bool
+	Duration  Metric     // http_req_duration of just this endpoint, with the trend stats
+	Responses *Responses `json:",omitempty"` // Statuses & error codes of just this endpoint
+	Apdex     *Apdex     `json:",omitempty"` // Only when scored with -slo
+}
+
+// endpointRecorder collects the HTTP samples of each endpoint, keyed by method & name
+type endpointRecorder struct {
+	endpoints map[string]*endpointSink
+	rules     *urlRules
+	names     map[string]string // Normalised URLs, keyed by raw URL, as the same URLs come up again & again
+}
+
+type endpointSink struct {
+	method        string
+	name          string
+	requests      float64
+	failed        float64
+	failedSamples float64
+	durations     *metricSink
+	responses     *responseRecorder
+	urls          map[string]bool
+}
+
+func newEndpointRecorder(rules *urlRules) *endpointRecorder {
+	return &endpointRecorder{endpoints: map[string]*endpointSink{}, rules: rules, names: map[string]string{}}
+}
+
+// add records a sample, if it's an HTTP request metric
+func (e *endpointRecorder) add(s sample) {
+	switch s.Metric {
+	case "http_reqs", "http_req_duration", "http_req_failed":
+	default:
+		return
+	}
+	method, name, url := e.name(s)
+	if name == "" {
+		return
+	}
+
+	key := method + " " + name
+	endpoint, ok := e.endpoints[key]
+	if !ok {
+		endpoint = &endpointSink{
+			method:    method,
+			name:      name,
+			durations: &metricSink{name: "http_req_duration", kind: builtinMetrics["http_req_duration"]},
+			responses: newResponseRecorder(),
+			urls:      map[string]bool{},
+		}
+		e.endpoints[key] = endpoint
+	}
+	if url != "" {
+		endpoint.urls[url] = true
+	}
+
+	switch s.Metric {
+	case "http_reqs":
+		endpoint.requests += s.Value
+		endpoint.responses.add(s)
+	case "http_req_duration":
+		endpoint.durations.add(s.Value)
+	case "http_req_failed":
+		endpoint.failedSamples++
+		if s.Value != 0 {
+			endpoint.failed++
+		}
+	}
+}
+
+// name gets the method & endpoint name of a sample, with URLs normalised, the name is empty if it isn't from a request
+func (e *endpointRecorder) name(s sample) (method, name, url string) {
+	method, name, url = s.Tags["method"], s.Tags["name"], s.Tags["url"]
+	if url != "" && (name == "" || name == url) {
+		normalised, ok := e.names[url]
+		if !ok {
+			normalised = e.rules.normalise(url)
+			e.names[url] = normalised
+		}
+		name = normalised
+	}
+	return method, name, url
+}
+
+// result computes the stats of every endpoint, sorted by name then method
+func (e *endpointRecorder) result(trendStats []string, duration time.Duration) []Endpoint {
+	endpoints := make([]Endpoint, 0, len(e.endpoints))
+	for _, sink := range e.endpoints {
+		endpoint := Endpoint{
+			Method:    sink.method,
+			Name:      sink.name,
+			URLs:      len(sink.urls),
+			Requests:  sink.requests,
+			RPS:       perSecond(sink.requests, duration),
+			Failed:    sink.failed,
+			HasErrors: sink.failedSamples > 0,
+			Duration: Metric{
+				Name:     sink.durations.name,
+				Type:     sink.durations.kind.Type,
+				Contains: sink.durations.kind.Contains,
+				Values:   sink.durations.stats(trendStats, duration),
+			},
+			Responses: sink.responses.result(),
+		}
+		if endpoint.HasErrors {
+			endpoint.ErrorRate = sink.failed / sink.failedSamples
+		}
+		endpoints = append(endpoints, endpoint)
+	}
+
+	sort.Slice(endpoints, func(i, j int) bool {
+		if endpoints[i].Name != endpoints[j].Name {
+			return endpoints[i].Name < endpoints[j].Name
+		}
+		return endpoints[i].Method < endpoints[j].Method
+	})
+	return endpoints
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestEndpointRecorder(t *testing.T) {
+	recorder := newEndpointRecorder(nil)
+	request := func(method, name, url string, duration float64, failed bool) {
+		tags := map[string]string{"method": method, "name": name, "url": url, "status": "200"}
+		failedValue := 0.0
+		if failed {
+			failedValue, tags["status"] = 1, "500"
+		}
+		recorder.add(sample{Metric: "http_reqs", Value: 1, Tags: tags})
+		recorder.add(sample{Metric: "http_req_duration", Value: duration, Tags: tags})
+		recorder.add(sample{Metric: "http_req_failed", Value: failedValue, Tags: tags})
+	}
+	request("GET", "https://tms.example.com/order/1?page=1", "https://tms.example.com/order/1?page=1", 100, false)
+	request("GET", "https://tms.example.com/order/2", "https://tms.example.com/order/2", 300, true)
+	request("POST", "https://tms.example.com/order/3", "https://tms.example.com/order/3", 50, false)
+	request("GET", "grouping route", "https://tms.example.com/grouping_route?date=2025-01-01", 900, false)
+	request("GET", "grouping route", "https://tms.example.com/grouping_route?date=2025-01-02", 700, false)
+	recorder.add(sample{Metric: "vus", Value: 10})
+	recorder.add(sample{Metric: "http_reqs", Value: 1, Tags: map[string]string{"method": "GET"}})
+
+	tests := []struct {
+		method    string
+		name      string
+		urls      int
+		requests  float64
+		errorRate float64
+		avg       float64
+	}{
+		{"GET", "grouping route", 2, 2, 0, 800},
+		{"GET", "https://tms.example.com/order/{id}", 2, 2, 0.5, 200},
+		{"POST", "https://tms.example.com/order/{id}", 1, 1, 0, 50},
+	}
+	endpoints := recorder.result([]string{"avg"}, 10*time.Second)
+	if len(endpoints) != len(tests) {
+		t.Fatalf("got %d endpoints %+v, want %d", len(endpoints), endpoints, len(tests))
+	}
+	for i, test := range tests {
+		t.Run(test.method+" "+test.name, func(t *testing.T) {
+			got := endpoints[i]
+			if got.Method != test.method || got.Name != test.name {
+				t.Fatalf("got %s %s, want %s %s", got.Method, got.Name, test.method, test.name)
+			}
+			if got.URLs != test.urls || got.Requests != test.requests || got.ErrorRate != test.errorRate {
+				t.Errorf("got %d urls, %v requests & error rate %v, want %d, %v & %v", got.URLs, got.Requests, got.ErrorRate, test.urls, test.requests, test.errorRate)
+			}
+			if got.RPS != test.requests/10 {
+				t.Errorf("got %v RPS, want %v", got.RPS, test.requests/10)
+			}
+			if avg := got.Duration.Values["avg"]; avg != test.avg {
+				t.Errorf("got avg %v, want %v", avg, test.avg)
+			}
+		})
+	}
+}
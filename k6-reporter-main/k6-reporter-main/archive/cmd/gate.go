@@ -0,0 +1,298 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+)
+
+// The gate command checks a candidate run against a baseline with a file of relative rules, for CI pipelines
+// K6 thresholds are absolute, rules are limits on how much worse than the baseline a result can get, e.g.
+//  {"rules": [
+//    {"metric": "http_req_duration{group:::kasir::grouping route}", "stat": "p(95)", "maxIncrease": 15},
+//    {"metric": "http_req_failed", "stat": "rate", "maxIncrease": 0.5},
+//    {"group": "kasir", "check": "status is 200", "maxDecrease": 1}
+//  ]}
+// Limits are in percent of the baseline, or percentage points for rates and check pass rates
+
+// Exit code of the gate command when a rule is violated, errors exit with 1 as usual
+const gateViolationExitCode = 2
+
+// gateRules is a rule file
+type gateRules struct {
+	Rules []gateRule `json:"rules"`
+}
+
+// gateRule is a single limit on the change of a metric stat, or of a group or check pass rate
+type gateRule struct {
+	Name         string   `json:"name"`
+	Metric       string   `json:"metric"` // Metric or submetric, submetrics are computed from ndjson & csv input
+	Stat         string   `json:"stat"`   // e.g. "p(95)", "avg" or "rate"
+	Group        string   `json:"group"`  // Group path, e.g. "kasir::grouping route", for a group or check pass rate
+	Check        string   `json:"check"`
+	MaxIncrease  *float64 `json:"maxIncrease"`
+	MaxDecrease  *float64 `json:"maxDecrease"`
+	AllowMissing bool     `json:"allowMissing"` // Pass the rule when either run doesn't have the value
+}
+
+// gateVerdict is the result of a rule
+type gateVerdict struct {
+	Rule      gateRule
+	Baseline  string
+	Candidate string
+	Change    string
+	Limit     string
+	Passed    bool
+	Reason    string
+}
+
+// runGate is the gate command
+func runGate(args []string) {
+	fs := flag.NewFlagSet("gate", flag.ExitOnError)
+	var rulesFile = fs.String("rules", "", "Rule file, JSON with a list of rules limiting changes from the baseline")
+	var baselineFile = fs.String("baseline", "", "Baseline results file, e.g. of the last green run on main, in any input format")
+	var candidateFile = fs.String("candidate", "", "Candidate results file, in any input format")
+	var inFlags = addInputFlags(fs)
+	_ = fs.Parse(args)
+	if *rulesFile == "" || *baselineFile == "" || *candidateFile == "" {
+		fmt.Printf("\n🚫 Rules or results not specified, please add -rules, -baseline and -candidate\n\n")
+		fs.PrintDefaults()
+		os.Exit(1)
+	}
+
+	rules, err := loadGateRules(*rulesFile)
+	if err != nil {
+		fmt.Println("💥 Rules file error", err)
+		os.Exit(1)
+	}
+	inOpts, err := inFlags.options()
+	if err != nil {
+		fmt.Println("💥 Input options error", err)
+		os.Exit(1)
+	}
+	// Raw sample input can compute any submetric and percentile the rules need
+	for _, rule := range rules.Rules {
+		if rule.Metric != baseMetricName(rule.Metric) {
+			inOpts.Submetrics = append(inOpts.Submetrics, rule.Metric)
+		}
+		if strings.HasPrefix(rule.Stat, "p(") && !containsString(inOpts.TrendStats, normaliseStat(rule.Stat)) {
+			inOpts.TrendStats = append(inOpts.TrendStats, normaliseStat(rule.Stat))
+		}
+	}
+
+	baseline, _, err := readResults(*baselineFile, inOpts)
+	if err != nil {
+		fmt.Println("💥 Baseline file error", err)
+		os.Exit(1)
+	}
+	candidate, _, err := readResults(*candidateFile, inOpts)
+	if err != nil {
+		fmt.Println("💥 Candidate file error", err)
+		os.Exit(1)
+	}
+
+	verdicts := evaluateGate(rules, baseline, candidate)
+	violations := 0
+	table := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(table, "\n\tRULE\tBASELINE\tCANDIDATE\tCHANGE\tLIMIT\t")
+	for _, verdict := range verdicts {
+		result := "✅"
+		if !verdict.Passed {
+			result = "❌"
+			violations++
+		}
+		fmt.Fprintf(table, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n", result, verdict.Rule.label(), verdict.Baseline, verdict.Candidate, verdict.Change, verdict.Limit, verdict.Reason)
+	}
+	_ = table.Flush()
+
+	if code := gateExitCode(verdicts); code != 0 {
+		fmt.Printf("\n🚧 Gate failed, %d of %d rules violated\n", violations, len(verdicts))
+		os.Exit(code)
+	}
+	fmt.Printf("\n🚦 Gate passed, all %d rules met\n", len(verdicts))
+}
+
+// gateExitCode is the exit code of the gate command, non-zero when any rule was violated
+func gateExitCode(verdicts []gateVerdict) int {
+	for _, verdict := range verdicts {
+		if !verdict.Passed {
+			return gateViolationExitCode
+		}
+	}
+	return 0
+}
+
+// loadGateRules reads and checks a rule file, unknown fields are an error so typos don't go unnoticed
+func loadGateRules(filename string) (*gateRules, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	rules := &gateRules{}
+	decoder := json.NewDecoder(file)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(rules); err != nil {
+		return nil, err
+	}
+	if len(rules.Rules) == 0 {
+		return nil, errors.New("no rules found")
+	}
+	for i, rule := range rules.Rules {
+		if err := rule.validate(); err != nil {
+			return nil, &DecodeError{Path: fmt.Sprintf("$.rules[%d]", i), Err: err}
+		}
+	}
+	return rules, nil
+}
+
+// validate checks a rule is for exactly one thing and has a limit
+func (r gateRule) validate() error {
+	switch {
+	case r.Metric != "" && (r.Group != "" || r.Check != ""):
+		return errors.New("a rule is either for a metric, or a group or check, not both")
+	case r.Metric != "" && r.Stat == "":
+		return fmt.Errorf("rule for metric %q has no stat, e.g. \"p(95)\"", r.Metric)
+	case r.Metric == "" && r.Group == "" && r.Check == "":
+		return errors.New("rule has no metric, group or check")
+	case r.MaxIncrease == nil && r.MaxDecrease == nil:
+		return errors.New("rule has no maxIncrease or maxDecrease limit")
+	}
+	return nil
+}
+
+// label is the name of a rule, or a description of what it's for
+func (r gateRule) label() string {
+	switch {
+	case r.Name != "":
+		return r.Name
+	case r.Metric != "":
+		return r.Metric + " " + r.Stat
+	case r.Check != "":
+		return groupLabel(groupRulePath(r.Group)) + ": " + r.Check
+	}
+	return groupLabel(groupRulePath(r.Group))
+}
+
+// evaluateGate checks every rule against the change from the baseline to the candidate
+func evaluateGate(rules *gateRules, baseline, candidate *ResultData) []gateVerdict {
+	english := locales["en"]
+	verdicts := []gateVerdict{}
+
+	for _, rule := range rules.Rules {
+		verdict := gateVerdict{Rule: rule}
+		var baseValue, candValue float64
+		var baseOK, candOK, points bool
+
+		if rule.Metric != "" {
+			stat := normaliseStat(rule.Stat)
+			base, inBase := baseline.Metrics[rule.Metric]
+			cand, inCand := candidate.Metrics[rule.Metric]
+			baseValue, baseOK = base.Values[stat]
+			candValue, candOK = cand.Values[stat]
+			baseOK, candOK = baseOK && inBase, candOK && inCand
+			metricType := cand.Type
+			if !inCand {
+				metricType = base.Type
+			}
+			points = metricType == "rate" && stat == "rate"
+			if baseOK {
+				verdict.Baseline = formatStatValue(english, base, stat, baseValue)
+			}
+			if candOK {
+				verdict.Candidate = formatStatValue(english, cand, stat, candValue)
+			}
+		} else {
+			baseValue, baseOK = rulePassRate(rule, baseline.RootGroup)
+			candValue, candOK = rulePassRate(rule, candidate.RootGroup)
+			points = true
+			if baseOK {
+				verdict.Baseline = english.FormatNumber(baseValue*100, 2) + "%"
+			}
+			if candOK {
+				verdict.Candidate = english.FormatNumber(candValue*100, 2) + "%"
+			}
+		}
+
+		unit := "%"
+		if points {
+			unit = " pp"
+		}
+		verdict.Limit = rule.limit(unit)
+
+		if !baseOK || !candOK {
+			verdict.Passed = rule.AllowMissing
+			verdict.Reason = "not found in the baseline"
+			if baseOK {
+				verdict.Reason = "not found in the candidate"
+			}
+			verdicts = append(verdicts, verdict)
+			continue
+		}
+
+		// A change from a zero baseline has no size in percent, so any change the limited way violates the rule
+		change := relativeChange(baseValue, candValue, points)
+		verdict.Change = fmt.Sprintf("%+.2f%s", change, unit)
+		fromZero := !points && baseValue == 0 && candValue != 0
+		if fromZero {
+			verdict.Change = "from zero"
+		}
+		verdict.Passed = true
+		if rule.MaxIncrease != nil && (change > *rule.MaxIncrease || fromZero && change > 0) {
+			verdict.Passed = false
+			verdict.Reason = "increased too much"
+		}
+		if rule.MaxDecrease != nil && (-change > *rule.MaxDecrease || fromZero && change < 0) {
+			verdict.Passed = false
+			verdict.Reason = "decreased too much"
+		}
+		verdicts = append(verdicts, verdict)
+	}
+
+	return verdicts
+}
+
+// limit describes the limits of a rule, e.g. "+15% / -5%"
+func (r gateRule) limit(unit string) string {
+	limits := []string{}
+	if r.MaxIncrease != nil {
+		limits = append(limits, fmt.Sprintf("+%g%s", *r.MaxIncrease, unit))
+	}
+	if r.MaxDecrease != nil {
+		limits = append(limits, fmt.Sprintf("-%g%s", *r.MaxDecrease, unit))
+	}
+	return strings.Join(limits, " / ")
+}
+
+// rulePassRate finds the pass rate of the group or check a rule is for
+func rulePassRate(rule gateRule, root Group) (float64, bool) {
+	groups := map[string]Group{}
+	collectGroups(root, groups)
+	group, ok := groups[groupRulePath(rule.Group)]
+	if !ok {
+		return 0, false
+	}
+	if rule.Check == "" {
+		return passRate(group.Passes, group.Fails), group.Passes+group.Fails > 0
+	}
+	for _, check := range group.Checks {
+		if check.Name == rule.Check {
+			return passRate(check.Passes, check.Fails), true
+		}
+	}
+	return 0, false
+}
+
+// groupRulePath turns the group of a rule into a group path, e.g. "kasir::grouping route" into "::kasir::grouping route"
+func groupRulePath(group string) string {
+	group = strings.TrimPrefix(group, groupPathSeparator)
+	if group == "" {
+		return ""
+	}
+	return groupPathSeparator + group
+}
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func limit(value float64) *float64 {
+	return &value
+}
+
+func gateResults(p95, failed float64, passes, fails int) *ResultData {
+	check := Check{Name: "status is 200", Path: "::kasir::status is 200", Passes: passes, Fails: fails}
+	return &ResultData{
+		Metrics: map[string]Metric{
+			"http_req_duration": {Type: "trend", Contains: "time", Values: map[string]float64{"p(95)": p95, "avg": p95 / 2}},
+			"http_req_failed":   {Type: "rate", Values: map[string]float64{"rate": failed}},
+		},
+		RootGroup: Group{Passes: passes, Fails: fails, Groups: []Group{
+			{Name: "kasir", Path: "::kasir", Passes: passes, Fails: fails, Checks: []Check{check}},
+		}},
+	}
+}
+
+func TestEvaluateGate(t *testing.T) {
+	baseline := gateResults(400, 0.01, 99, 1)
+	candidate := gateResults(440, 0.02, 95, 5)
+	baseline.Metrics["dropped_iterations"] = Metric{Type: "counter", Values: map[string]float64{"count": 0, "rate": 0}}
+	candidate.Metrics["dropped_iterations"] = Metric{Type: "counter", Values: map[string]float64{"count": 50, "rate": 0}}
+
+	tests := []struct {
+		name   string
+		rule   gateRule
+		passed bool
+		change string
+		reason string
+	}{
+		{"within increase", gateRule{Metric: "http_req_duration", Stat: "p(95)", MaxIncrease: limit(15)}, true, "+10.00%", ""},
+		{"over increase", gateRule{Metric: "http_req_duration", Stat: "p(95.0)", MaxIncrease: limit(5)}, false, "+10.00%", "increased too much"},
+		{"rate in points", gateRule{Metric: "http_req_failed", Stat: "rate", MaxIncrease: limit(0.5)}, false, "+1.00 pp", "increased too much"},
+		{"check over decrease", gateRule{Group: "kasir", Check: "status is 200", MaxDecrease: limit(1)}, false, "-4.00 pp", "decreased too much"},
+		{"group within decrease", gateRule{Group: "::kasir", MaxDecrease: limit(5)}, true, "-4.00 pp", ""},
+		{"increase from zero", gateRule{Metric: "dropped_iterations", Stat: "count", MaxIncrease: limit(1000)}, false, "from zero", "increased too much"},
+		{"only decrease limited from zero", gateRule{Metric: "dropped_iterations", Stat: "count", MaxDecrease: limit(10)}, true, "from zero", ""},
+		{"zero to zero", gateRule{Metric: "dropped_iterations", Stat: "rate", MaxIncrease: limit(0)}, true, "+0.00%", ""},
+		{"missing stat", gateRule{Metric: "http_req_duration", Stat: "p(99)", MaxIncrease: limit(15)}, false, "", "not found in the baseline"},
+		{"allowed missing", gateRule{Metric: "grpc_req_duration", Stat: "avg", MaxIncrease: limit(15), AllowMissing: true}, true, "", "not found in the baseline"},
+		{"unknown check", gateRule{Group: "kasir", Check: "body has total", MaxDecrease: limit(1)}, false, "", "not found in the baseline"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			verdicts := evaluateGate(&gateRules{Rules: []gateRule{test.rule}}, baseline, candidate)
+			if len(verdicts) != 1 {
+				t.Fatalf("got %d verdicts, want 1", len(verdicts))
+			}
+			verdict := verdicts[0]
+			if verdict.Passed != test.passed || verdict.Change != test.change || verdict.Reason != test.reason {
+				t.Errorf("got passed %v, change %q & reason %q, want %v, %q & %q", verdict.Passed, verdict.Change, verdict.Reason, test.passed, test.change, test.reason)
+			}
+		})
+	}
+
+	// Only the candidate is missing the metric
+	candidate.Metrics = map[string]Metric{}
+	verdicts := evaluateGate(&gateRules{Rules: []gateRule{tests[0].rule}}, baseline, candidate)
+	if verdicts[0].Passed || verdicts[0].Reason != "not found in the candidate" || verdicts[0].Baseline == "" || verdicts[0].Candidate != "" {
+		t.Errorf("got %+v, want a verdict missing the candidate", verdicts[0])
+	}
+}
+
+func TestGateRuleValidate(t *testing.T) {
+	tests := []struct {
+		name  string
+		rule  gateRule
+		valid bool
+	}{
+		{"metric", gateRule{Metric: "http_req_duration", Stat: "p(95)", MaxIncrease: limit(10)}, true},
+		{"check", gateRule{Group: "kasir", Check: "status is 200", MaxDecrease: limit(1)}, true},
+		{"root check", gateRule{Check: "status is 200", MaxDecrease: limit(1)}, true},
+		{"metric & group", gateRule{Metric: "http_req_duration", Stat: "avg", Group: "kasir", MaxIncrease: limit(10)}, false},
+		{"metric without stat", gateRule{Metric: "http_req_duration", MaxIncrease: limit(10)}, false},
+		{"nothing to check", gateRule{MaxIncrease: limit(10)}, false},
+		{"no limit", gateRule{Metric: "http_req_duration", Stat: "avg"}, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if err := test.rule.validate(); (err == nil) != test.valid {
+				t.Errorf("got %v, want valid %v", err, test.valid)
+			}
+		})
+	}
+}
+
+func TestLoadGateRules(t *testing.T) {
+	tests := []struct {
+		name  string
+		rules string
+		path  string
+		valid bool
+	}{
+		{"valid", `{"rules": [{"metric": "http_req_duration", "stat": "p(95)", "maxIncrease": 15}]}`, "", true},
+		{"no rules", `{"rules": []}`, "", false},
+		{"unknown field", `{"rules": [{"metric": "http_req_duration", "stat": "p(95)", "maxIncrese": 15}]}`, "", false},
+		{"invalid rule", `{"rules": [{"check": "status is 200", "maxDecrease": 1}, {"metric": "vus", "maxIncrease": 1}]}`, "$.rules[1]", false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			filename := filepath.Join(t.TempDir(), "rules.json")
+			if err := os.WriteFile(filename, []byte(test.rules), 0644); err != nil {
+				t.Fatal(err)
+			}
+			_, err := loadGateRules(filename)
+			if (err == nil) != test.valid {
+				t.Fatalf("got %v, want valid %v", err, test.valid)
+			}
+			var decodeErr *DecodeError
+			if test.path != "" && (!errors.As(err, &decodeErr) || decodeErr.Path != test.path) {
+				t.Errorf("got %v, want an error at %s", err, test.path)
+			}
+		})
+	}
+}
+
+func TestGateExitCode(t *testing.T) {
+	if gateExitCode([]gateVerdict{{Passed: true}, {Passed: true}}) != 0 {
+		t.Error("got a non-zero exit code when every rule passed")
+	}
+	if code := gateExitCode([]gateVerdict{{Passed: true}, {Passed: false}}); code != gateViolationExitCode {
+		t.Errorf("got exit code %d for a violation, want %d", code, gateViolationExitCode)
+	}
+}
+
+// The gate command is run in a child process of the test, as it exits
+func TestRunGateExitCode(t *testing.T) {
+	if args := os.Getenv("GATE_TEST_ARGS"); args != "" {
+		runGate(strings.Split(args, "\n"))
+		os.Exit(0)
+	}
+
+	dir := t.TempDir()
+	files := map[string]string{
+		"baseline.json":  `{"metrics": {"http_req_duration": {"type": "trend", "contains": "time", "values": {"p(95)": 400}}}}`,
+		"candidate.json": `{"metrics": {"http_req_duration": {"type": "trend", "contains": "time", "values": {"p(95)": 440}}}}`,
+		"broken.json":    `{"metrics": {"http_req_duration": {"type": "trend", "values": {"p(95)": "slow"}}}}`,
+		"lenient.json":   `{"rules": [{"metric": "http_req_duration", "stat": "p(95)", "maxIncrease": 15}]}`,
+		"strict.json":    `{"rules": [{"metric": "http_req_duration", "stat": "p(95)", "maxIncrease": 5}]}`,
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name      string
+		rules     string
+		candidate string
+		want      int
+	}{
+		{"rules met", "lenient.json", "candidate.json", 0},
+		{"rule violated", "strict.json", "candidate.json", gateViolationExitCode},
+		{"missing rules file", "missing.json", "candidate.json", 1},
+		{"malformed candidate", "lenient.json", "broken.json", 1},
+		{"no rules flag", "", "candidate.json", 1},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			args := []string{"-baseline", filepath.Join(dir, "baseline.json"), "-candidate", filepath.Join(dir, test.candidate)}
+			if test.rules != "" {
+				args = append(args, "-rules", filepath.Join(dir, test.rules))
+			}
+			cmd := exec.Command(os.Args[0], "-test.run=^TestRunGateExitCode$")
+			cmd.Env = append(os.Environ(), "GATE_TEST_ARGS="+strings.Join(args, "\n"))
+			err := cmd.Run()
+
+			code := 0
+			var exitErr *exec.ExitError
+			if errors.As(err, &exitErr) {
+				code = exitErr.ExitCode()
+			} else if err != nil {
+				t.Fatal(err)
+			}
+			if code != test.want {
+				t.Errorf("got exit code %d, want %d", code, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"strings"
+)
+
+// K6 joins the names of nested groups with this separator to form the group path
+const groupPathSeparator = "::"
+
+// rollupGroup totals the check passes & fails of a group and every group nested under it
+func rollupGroup(group *Group) {
+	group.Passes = 0
+	group.Fails = 0
+	if group.ID == "" {
+		group.ID = groupID(group.Path)
+	}
+
+	for _, check := range group.Checks {
+		group.Passes += check.Passes
+		group.Fails += check.Fails
+	}
+
+	for i := range group.Groups {
+		rollupGroup(&group.Groups[i])
+		group.Passes += group.Groups[i].Passes
+		group.Fails += group.Groups[i].Fails
+	}
+}
+
+// groupID is the same ID K6 gives a group, the MD5 hash of its path
+func groupID(path string) string {
+	hash := md5.Sum([]byte(path))
+	return hex.EncodeToString(hash[:])
+}
+
+// groupPathLabel turns a group path into something readable, e.g. "kasir › grouping route › save"
+func groupPathLabel(path string) string {
+	return strings.ReplaceAll(strings.TrimPrefix(path, groupPathSeparator), groupPathSeparator, " › ")
+}
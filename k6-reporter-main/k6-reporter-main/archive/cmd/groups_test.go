@@ -0,0 +1,63 @@
+package main
+
+import "testing"
+
+func TestRollupGroup(t *testing.T) {
+	root := Group{
+		Passes: 99, Fails: 99, // Stale counts are replaced
+		Checks: []Check{{Name: "is up", Passes: 5, Fails: 1}},
+		Groups: []Group{
+			{Name: "kasir", Path: "::kasir", ID: "given", Checks: []Check{{Passes: 3, Fails: 2}, {Passes: 4}}, Groups: []Group{
+				{Name: "save", Path: "::kasir::save", Checks: []Check{{Passes: 1, Fails: 7}}},
+			}},
+			{Name: "empty", Path: "::empty"},
+		},
+	}
+	rollupGroup(&root)
+
+	tests := []struct {
+		name   string
+		group  Group
+		passes int
+		fails  int
+		id     string
+	}{
+		{"root", root, 13, 10, groupID("")},
+		{"kasir", root.Groups[0], 8, 9, "given"},
+		{"save", root.Groups[0].Groups[0], 1, 7, groupID("::kasir::save")},
+		{"empty", root.Groups[1], 0, 0, groupID("::empty")},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if test.group.Passes != test.passes || test.group.Fails != test.fails || test.group.ID != test.id {
+				t.Errorf("got %d passes, %d fails & ID %s, want %d, %d & %s", test.group.Passes, test.group.Fails, test.group.ID, test.passes, test.fails, test.id)
+			}
+		})
+	}
+}
+
+func TestGroupID(t *testing.T) {
+	// IDs K6 gives the root group & a group named kasir
+	if got := groupID(""); got != "d41d8cd98f00b204e9800998ecf8427e" {
+		t.Errorf("got root ID %s", got)
+	}
+	if got := groupID("::kasir"); got != "56e8ff0ef37a0e9189a51b6bd39018e8" {
+		t.Errorf("got kasir ID %s", got)
+	}
+}
+
+func TestGroupPathLabel(t *testing.T) {
+	tests := []struct {
+		path string
+		want string
+	}{
+		{"", ""},
+		{"::kasir", "kasir"},
+		{"::kasir::grouping route::save", "kasir › grouping route › save"},
+	}
+	for _, test := range tests {
+		if got := groupPathLabel(test.path); got != test.want {
+			t.Errorf("got %q, want %q", got, test.want)
+		}
+	}
+}
@@ -0,0 +1,544 @@
+package main
+
+import (
+	"crypto/md5"
+	_ "embed"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"html/template"
+	"math"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+)
+
+// The history store keeps every converted run in a local directory, so results can be charted across runs
+//  history/index.json     - every run, with the headline figures used for charts
+//  history/runs/<id>.json - the full results of a run
+// Runs are indexed by script, environment, git commit, label and timestamp
+// Run files are written before the index, so the index can always be rebuilt from them. Many processes can share a store,
+// e.g. CI jobs & the serve command, if one's index write drops a run another just stored, it's put back on the next read
+
+//go:embed "templates/history.tmpl"
+var historyTemplateString string
+
+// Default title pattern of history reports
+const defaultHistoryTitlePattern = "K6 History: {title}"
+
+// Environment variables CI systems put the git commit in, used when -commit isn't given
+var commitEnvVars = []string{"GIT_COMMIT", "GITHUB_SHA", "CI_COMMIT_SHA", "BUILD_SOURCEVERSION"}
+
+// Run IDs are only ever made of these, anything else isn't a run
+var runIDPattern = regexp.MustCompile(`^[0-9A-Za-z-]+$`)
+
+// Run is a single stored run, as listed in the history index
+type Run struct {
+	ID          string     `json:"id"`
+	Script      string     `json:"script"`
+	Environment string     `json:"environment"`
+	Commit      string     `json:"commit"`
+	Label       string     `json:"label"`
+	Timestamp   time.Time  `json:"timestamp"` // When the run started, or when it was stored if that's not known
+	Title       string     `json:"title"`
+	InputFile   string     `json:"inputFile"`
+	InputFormat string     `json:"inputFormat"`
+	DurationMs  float64    `json:"durationMs"`
+	Summary     RunSummary `json:"summary"`
+}
+
+// RunSummary holds the headline figures of a run, kept in the index so charts don't need every run loaded
+type RunSummary struct {
+	P95               float64 `json:"p95"`       // http_req_duration p(95) in ms
+	ErrorRate         float64 `json:"errorRate"` // http_req_failed rate
+	RPS               float64 `json:"rps"`       // http_reqs per second
+	CheckFailureRate  float64 `json:"checkFailureRate"`
+	ThresholdFailures int     `json:"thresholdFailures"`
+}
+
+// storedRun is the file a run's results are kept in, start & end aren't part of the results JSON
+type storedRun struct {
+	Run       Run         `json:"run"`
+	StartTime time.Time   `json:"startTime"`
+	EndTime   time.Time   `json:"endTime"`
+	Results   *ResultData `json:"results"`
+}
+
+// runFilter selects runs from the history, empty fields match everything
+type runFilter struct {
+	Script      string
+	Environment string
+	Commit      string
+	Label       string
+	Last        int // Only the most recent runs, 0 for all
+}
+
+// historyStore is the directory runs are stored in, safe to use from many goroutines & processes
+type historyStore struct {
+	dir string
+	mu  sync.Mutex
+}
+
+// HistoryView is the data the history template is rendered with
+type HistoryView struct {
+	Brand       Branding
+	Generated   time.Time
+	Script      string
+	Environment string
+	Runs        []Run   // Oldest first
+	Charts      []Chart // One for each headline figure
+}
+
+// runFlags are the command line flags describing a run being stored
+type runFlags struct {
+	script      *string
+	environment *string
+	commit      *string
+	label       *string
+}
+
+// addRunFlags adds the flags describing a run to a flag set
+func addRunFlags(fs *flag.FlagSet) *runFlags {
+	return &runFlags{
+		script:      fs.String("script", "", "Test script of the run for the history, defaults to the title made from the input filename"),
+		environment: fs.String("env", "", "Environment the run was against for the history, e.g. staging"),
+		commit:      fs.String("commit", "", "Git commit of the run for the history, defaults to $GIT_COMMIT, $GITHUB_SHA, $CI_COMMIT_SHA or $BUILD_SOURCEVERSION"),
+		label:       fs.String("label", "", "Free text label of the run for the history, e.g. nightly"),
+	}
+}
+
+// run describes results being stored, using the flags & what's known from the results
+func (f *runFlags) run(resultData *ResultData, inputFile, inputFormat string) Run {
+	run := Run{Script: *f.script, Environment: *f.environment, Commit: *f.commit, Label: *f.label}
+	for _, name := range commitEnvVars {
+		if run.Commit == "" {
+			run.Commit = os.Getenv(name)
+		}
+	}
+	return describeRun(run, resultData, inputFile, inputFormat)
+}
+
+// describeRun fills in what's known from the results of a run, on top of its script, environment, commit & label
+func describeRun(run Run, resultData *ResultData, inputFile, inputFormat string) Run {
+	run.Timestamp = resultData.State.StartTime
+	run.Title = resultData.Title
+	run.InputFile = filepath.Base(inputFile)
+	run.InputFormat = inputFormat
+	run.DurationMs = resultData.State.TestRunDurationMs
+	run.Summary = summariseRun(resultData)
+	if run.Script == "" {
+		run.Script = resultData.Title
+	}
+	if run.Timestamp.IsZero() {
+		run.Timestamp = time.Now()
+	}
+	run.Timestamp = run.Timestamp.UTC()
+	return run
+}
+
+// summariseRun picks out the headline figures of a run
+func summariseRun(resultData *ResultData) RunSummary {
+	summary := RunSummary{
+		P95:               metricValue(resultData.Metrics, "http_req_duration", "p(95)"),
+		ErrorRate:         metricValue(resultData.Metrics, "http_req_failed", "rate"),
+		RPS:               metricValue(resultData.Metrics, "http_reqs", "rate"),
+		ThresholdFailures: resultData.ThresholdFailures,
+	}
+	if total := resultData.CheckPasses + resultData.CheckFailures; total > 0 {
+		summary.CheckFailureRate = float64(resultData.CheckFailures) / float64(total)
+	}
+	return summary
+}
+
+// openHistory opens a history store, creating the directory if needed
+func openHistory(dir string) (*historyStore, error) {
+	if err := os.MkdirAll(filepath.Join(dir, "runs"), 0o755); err != nil {
+		return nil, err
+	}
+	return &historyStore{dir: dir}, nil
+}
+
+// add stores the results of a run, returning the run with its new ID
+func (h *historyStore) add(run Run, resultData *ResultData) (Run, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	stored := storedRun{Run: run, StartTime: resultData.State.StartTime, EndTime: resultData.State.EndTime, Results: resultData}
+	data, err := json.Marshal(stored)
+	if err != nil {
+		return run, err
+	}
+	hash := md5.Sum(data)
+	run.ID = run.Timestamp.Format("20060102-150405") + "-" + hex.EncodeToString(hash[:4])
+	stored.Run = run
+	if data, err = json.Marshal(stored); err != nil {
+		return run, err
+	}
+
+	if err := writeFileAtomic(h.runFile(run.ID), data); err != nil {
+		return run, err
+	}
+	// Reading the index after the run file is written picks the run up, along with any stored by other processes meanwhile
+	runs, err := h.readIndex()
+	if err != nil {
+		return run, err
+	}
+	return run, h.writeIndex(runs)
+}
+
+// list finds the runs matching a filter, oldest first
+func (h *historyStore) list(filter runFilter) ([]Run, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	runs, err := h.readIndex()
+	if err != nil {
+		return nil, err
+	}
+	matched := []Run{}
+	for _, run := range runs {
+		if filter.matches(run) {
+			matched = append(matched, run)
+		}
+	}
+	sort.SliceStable(matched, func(i, j int) bool {
+		return matched[i].Timestamp.Before(matched[j].Timestamp)
+	})
+	if filter.Last > 0 && len(matched) > filter.Last {
+		matched = matched[len(matched)-filter.Last:]
+	}
+	return matched, nil
+}
+
+// trend lists the runs charted together, one script in one environment, which default to those of the newest run
+// matching the filter, as figures of different scripts or environments aren't comparable
+func (h *historyStore) trend(filter runFilter) ([]Run, runFilter, error) {
+	if filter.Script == "" || filter.Environment == "" {
+		runs, err := h.list(runFilter{Script: filter.Script, Environment: filter.Environment, Commit: filter.Commit, Label: filter.Label, Last: 1})
+		if err != nil || len(runs) == 0 {
+			return runs, filter, err
+		}
+		filter.Script, filter.Environment = runs[0].Script, runs[0].Environment
+	}
+	runs, err := h.list(filter)
+	return runs, filter, err
+}
+
+// load reads the full results of a stored run
+func (h *historyStore) load(id string) (*ResultData, Run, error) {
+	if !runIDPattern.MatchString(id) {
+		return nil, Run{}, fmt.Errorf("invalid run ID %q", id)
+	}
+	data, err := os.ReadFile(h.runFile(id))
+	if err != nil {
+		return nil, Run{}, err
+	}
+
+	stored := storedRun{}
+	if err := json.Unmarshal(data, &stored); err != nil {
+		return nil, Run{}, &DecodeError{Path: id, Err: err}
+	}
+	if stored.Results == nil {
+		return nil, Run{}, &DecodeError{Path: id, Err: errors.New("no results in stored run")}
+	}
+	resultData := stored.Results
+	resultData.State.StartTime, resultData.State.EndTime = stored.StartTime, stored.EndTime
+	evaluateThresholds(resultData)
+	rollupGroup(&resultData.RootGroup)
+	return resultData, stored.Run, nil
+}
+
+func (h *historyStore) runFile(id string) string {
+	return filepath.Join(h.dir, "runs", id+".json")
+}
+
+// readIndex reads the index, along with any stored runs missing from it
+func (h *historyStore) readIndex() ([]Run, error) {
+	runs := []Run{}
+	data, err := os.ReadFile(filepath.Join(h.dir, "index.json"))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	if err == nil {
+		if err := json.Unmarshal(data, &runs); err != nil {
+			return nil, &DecodeError{Path: "index.json", Err: err}
+		}
+	}
+
+	files, err := filepath.Glob(filepath.Join(h.dir, "runs", "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	indexed := map[string]bool{}
+	for _, run := range runs {
+		indexed[run.ID] = true
+	}
+	for _, file := range files {
+		id := strings.TrimSuffix(filepath.Base(file), ".json")
+		if indexed[id] || !runIDPattern.MatchString(id) {
+			continue
+		}
+		run, err := readStoredRun(file)
+		if err != nil {
+			return nil, &DecodeError{Path: id, Err: err}
+		}
+		runs = append(runs, run)
+	}
+	return runs, nil
+}
+
+// readStoredRun reads just the run description of a stored run
+func readStoredRun(filename string) (Run, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return Run{}, err
+	}
+	stored := struct {
+		Run Run `json:"run"`
+	}{}
+	err = json.Unmarshal(data, &stored)
+	return stored.Run, err
+}
+
+func (h *historyStore) writeIndex(runs []Run) error {
+	data, err := json.MarshalIndent(runs, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(filepath.Join(h.dir, "index.json"), data)
+}
+
+// writeFileAtomic writes to a temporary file then renames it, so readers never see a half written file
+// The temporary file has a unique name, so writers in other processes can't clobber it
+func writeFileAtomic(filename string, data []byte) error {
+	temp, err := os.CreateTemp(filepath.Dir(filename), filepath.Base(filename)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(temp.Name()) // Only left to remove if something failed before the rename
+
+	if _, err := temp.Write(data); err != nil {
+		temp.Close()
+		return err
+	}
+	if err := temp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(temp.Name(), 0o644); err != nil {
+		return err
+	}
+	return os.Rename(temp.Name(), filename)
+}
+
+// matches checks if a run is selected by the filter
+func (f runFilter) matches(run Run) bool {
+	return (f.Script == "" || f.Script == run.Script) &&
+		(f.Environment == "" || f.Environment == run.Environment) &&
+		(f.Commit == "" || f.Commit == run.Commit) &&
+		(f.Label == "" || f.Label == run.Label)
+}
+
+// addFilterFlags adds the flags to select runs from the history to a flag set
+func addFilterFlags(fs *flag.FlagSet, filter *runFilter, last int) {
+	fs.StringVar(&filter.Script, "script", "", "Only runs of this test script")
+	fs.StringVar(&filter.Environment, "env", "", "Only runs against this environment")
+	fs.StringVar(&filter.Commit, "commit", "", "Only runs of this git commit")
+	fs.StringVar(&filter.Label, "label", "", "Only runs with this label")
+	fs.IntVar(&filter.Last, "last", last, "Only the most recent runs, 0 for all")
+}
+
+// runHistory is the history command, with add, list & chart sub commands
+func runHistory(args []string) {
+	if len(args) == 0 {
+		fmt.Printf("\n🚫 History command not specified, use add, list or chart\n\n")
+		os.Exit(1)
+	}
+
+	fs := flag.NewFlagSet("history "+args[0], flag.ExitOnError)
+	var historyDir = fs.String("history", "./history", "Directory of the history store")
+	switch args[0] {
+	case "add":
+		var inFilename = fs.String("infile", "", "Results file to add, in any input format")
+		var inFlags = addInputFlags(fs)
+		var runOpts = addRunFlags(fs)
+		_ = fs.Parse(args[1:])
+		if *inFilename == "" {
+			fmt.Printf("\n🚫 Input file not specified, please add -infile\n\n")
+			fs.PrintDefaults()
+			os.Exit(1)
+		}
+		inOpts, err := inFlags.options()
+		if err != nil {
+			fmt.Println("💥 Input options error", err)
+			os.Exit(1)
+		}
+		resultData, formatName, err := readResults(*inFilename, inOpts)
+		if err != nil {
+			fmt.Println("💥 Input file error", err)
+			os.Exit(1)
+		}
+		storeRun(*historyDir, runOpts.run(resultData, *inFilename, formatName), resultData)
+
+	case "list":
+		var filter runFilter
+		addFilterFlags(fs, &filter, 0)
+		_ = fs.Parse(args[1:])
+		store, err := openHistory(*historyDir)
+		if err != nil {
+			fmt.Println("💥 History error", err)
+			os.Exit(1)
+		}
+		runs, err := store.list(filter)
+		if err != nil {
+			fmt.Println("💥 History error", err)
+			os.Exit(1)
+		}
+		table := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(table, "\nID\tTIMESTAMP\tSCRIPT\tENV\tCOMMIT\tLABEL\tP95\tERRORS\tRPS\t")
+		for _, run := range runs {
+			fmt.Fprintf(table, "%s\t%s\t%s\t%s\t%s\t%s\t%.2f ms\t%.2f%%\t%.2f/s\t\n", run.ID, run.Timestamp.Format(time.RFC3339),
+				run.Script, run.Environment, shortCommit(run.Commit), run.Label, run.Summary.P95, run.Summary.ErrorRate*100, run.Summary.RPS)
+		}
+		_ = table.Flush()
+
+	case "chart":
+		var filter runFilter
+		addFilterFlags(fs, &filter, 20)
+		var outFilename = fs.String("outfile", "./history.html", "Output HTML filename")
+		var brandOpts = brandingOptions{}
+		addBrandingFlags(fs, &brandOpts, defaultHistoryTitlePattern)
+		var localeFlags = addLocaleFlags(fs)
+		_ = fs.Parse(args[1:])
+		locale, zone, err := localeFlags.resolve()
+		if err != nil {
+			fmt.Println("💥 Locale error", err)
+			os.Exit(1)
+		}
+		store, err := openHistory(*historyDir)
+		if err != nil {
+			fmt.Println("💥 History error", err)
+			os.Exit(1)
+		}
+		runs, filter, err := store.trend(filter)
+		if err != nil {
+			fmt.Println("💥 History error", err)
+			os.Exit(1)
+		}
+		if len(runs) == 0 {
+			fmt.Printf("\n🚫 No runs found in the history at: %s\n\n", *historyDir)
+			os.Exit(1)
+		}
+		view, err := newHistoryView(runs, filter, brandOpts, locale, zone)
+		if err != nil {
+			fmt.Println("💥 Branding error", err)
+			os.Exit(1)
+		}
+		if err := writeHistoryReport(*outFilename, view, locale, zone); err != nil {
+			fmt.Println("💥 Output file error", err)
+			os.Exit(1)
+		}
+		fmt.Printf("\n📈 Done! History of %d runs written to: %s\n", len(runs), *outFilename)
+
+	default:
+		fmt.Printf("\n🚫 Unknown history command %q, use add, list or chart\n\n", args[0])
+		os.Exit(1)
+	}
+}
+
+// storeRun adds a run to the history store, reporting what happened
+func storeRun(historyDir string, run Run, resultData *ResultData) {
+	store, err := openHistory(historyDir)
+	if err == nil {
+		run, err = store.add(run, resultData)
+	}
+	if err != nil {
+		fmt.Println("💥 History error", err)
+		os.Exit(1)
+	}
+	fmt.Printf("\n🗄️  Run %s of %s stored in the history at: %s\n", run.ID, run.Script, historyDir)
+}
+
+// newHistoryView charts the headline figures of runs, which are in order oldest first
+func newHistoryView(runs []Run, filter runFilter, brandOpts brandingOptions, locale *Locale, zone *time.Location) (HistoryView, error) {
+	view := HistoryView{Generated: time.Now(), Script: filter.Script, Environment: filter.Environment, Runs: runs}
+	var err error
+	if view.Brand, err = newBranding(brandOpts, filter.Script, view.Generated); err != nil {
+		return view, err
+	}
+
+	// Runs are evenly spaced along the X axis, labelled with their date
+	runDate := func(x float64) string {
+		i := int(math.Round(x))
+		if i < 0 || i >= len(runs) {
+			return ""
+		}
+		return runs[i].Timestamp.In(zone).Format("2006-01-02")
+	}
+	milliseconds := func(v float64) string { return formatMs(locale, v) }
+	percentage := func(v float64) string { return locale.FormatNumber(v*100, 1) + "%" }
+	perSecond := func(v float64) string { return locale.FormatNumber(v, 1) + "/s" }
+
+	figures := []struct {
+		label  string
+		value  func(RunSummary) float64
+		format func(float64) string
+	}{
+		{"p95Latency", func(s RunSummary) float64 { return s.P95 }, milliseconds},
+		{"errorRate", func(s RunSummary) float64 { return s.ErrorRate }, percentage},
+		{"rps", func(s RunSummary) float64 { return s.RPS }, perSecond},
+		{"checkFailureRate", func(s RunSummary) float64 { return s.CheckFailureRate }, percentage},
+	}
+	for _, figure := range figures {
+		series := chartSeries{Name: locale.T(figure.label)}
+		for i, run := range runs {
+			value := figure.value(run.Summary)
+			label := fmt.Sprintf("%s %s: %s", runDate(float64(i)), shortCommit(run.Commit), figure.format(value))
+			series.Points = append(series.Points, chartPoint{X: float64(i), Y: value, Label: label})
+		}
+		chart := lineChart(series.Name, []chartSeries{series}, figure.format, runDate)
+		view.Charts = append(view.Charts, Chart{Title: series.Name, SVG: chart})
+	}
+
+	return view, nil
+}
+
+// newHistoryTemplate parses the history template, along with the report template it shares styles & icons with
+func newHistoryTemplate(locale *Locale, zone *time.Location) (*template.Template, error) {
+	tmpl, err := newReportTemplate("", locale, zone)
+	if err != nil {
+		return nil, err
+	}
+	return tmpl.Parse(historyTemplateString)
+}
+
+// writeHistoryReport renders the history HTML report
+func writeHistoryReport(filename string, view HistoryView, locale *Locale, zone *time.Location) error {
+	tmpl, err := newHistoryTemplate(locale, zone)
+	if err != nil {
+		return err
+	}
+	outFile, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	defer outFile.Close()
+	return tmpl.Execute(outFile, view)
+}
+
+// Length of a short commit hash, the default of git's --abbrev
+const shortCommitLength = 7
+
+// shortCommit shortens a git commit hash to the length git shows by default
+func shortCommit(commit string) string {
+	if len(commit) > shortCommitLength {
+		return commit[:shortCommitLength]
+	}
+	return commit
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestHistoryConcurrentAdds(t *testing.T) {
+	dir := t.TempDir()
+	start := time.Date(2025, 1, 1, 3, 0, 0, 0, time.UTC)
+
+	// Each store has its own mutex, the same as separate processes sharing a directory
+	var wg sync.WaitGroup
+	errs := make(chan error, 20)
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			store, err := openHistory(dir)
+			if err == nil {
+				run := Run{Script: "soak", Timestamp: start.Add(time.Duration(i) * time.Minute)}
+				_, err = store.add(run, &ResultData{Title: fmt.Sprint("run ", i), Metrics: map[string]Metric{}})
+			}
+			errs <- err
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	store, _ := openHistory(dir)
+	runs, err := store.list(runFilter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(runs) != 20 {
+		t.Errorf("got %d runs, want 20", len(runs))
+	}
+	temps, _ := filepath.Glob(filepath.Join(dir, "*.tmp"))
+	if len(temps) > 0 {
+		t.Errorf("temporary files left behind: %v", temps)
+	}
+}
+
+func TestHistoryIndexMissingRun(t *testing.T) {
+	dir := t.TempDir()
+	store, _ := openHistory(dir)
+	first, err := store.add(Run{Script: "a", Timestamp: time.Date(2025, 1, 1, 3, 0, 0, 0, time.UTC)}, &ResultData{Metrics: map[string]Metric{}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.add(Run{Script: "b", Timestamp: time.Date(2025, 1, 2, 3, 0, 0, 0, time.UTC)}, &ResultData{Metrics: map[string]Metric{}}); err != nil {
+		t.Fatal(err)
+	}
+
+	// An index written by another process that hadn't seen the second run
+	if err := store.writeIndex([]Run{first}); err != nil {
+		t.Fatal(err)
+	}
+	runs, err := store.list(runFilter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(runs) != 2 || runs[1].Script != "b" {
+		t.Errorf("got runs %+v, want a & b", runs)
+	}
+}
+
+func TestHistoryTrend(t *testing.T) {
+	store, _ := openHistory(t.TempDir())
+	for day, run := range []Run{
+		{Script: "a.js", Environment: "staging"},
+		{Script: "b.js", Environment: "staging"},
+		{Script: "a.js", Environment: "prod"},
+		{Script: "a.js", Environment: "staging"},
+		{Script: "b.js", Environment: "prod"},
+	} {
+		run.Timestamp = time.Date(2025, 1, day+1, 3, 0, 0, 0, time.UTC)
+		if _, err := store.add(run, &ResultData{Metrics: map[string]Metric{}}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name   string
+		filter runFilter
+		script string
+		env    string
+		runs   int
+	}{
+		{"newest run", runFilter{}, "b.js", "prod", 1},
+		{"script only", runFilter{Script: "a.js"}, "a.js", "staging", 2},
+		{"env only", runFilter{Environment: "staging"}, "a.js", "staging", 2},
+		{"both", runFilter{Script: "b.js", Environment: "staging"}, "b.js", "staging", 1},
+		{"no match", runFilter{Script: "c.js"}, "c.js", "", 0},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			runs, filter, err := store.trend(test.filter)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if filter.Script != test.script || filter.Environment != test.env || len(runs) != test.runs {
+				t.Errorf("got %d runs of %s in %s, want %d of %s in %s", len(runs), filter.Script, filter.Environment, test.runs, test.script, test.env)
+			}
+			for _, run := range runs {
+				if run.Script != filter.Script || run.Environment != filter.Environment {
+					t.Errorf("got run of %s in %s, want only %s in %s", run.Script, run.Environment, filter.Script, filter.Environment)
+				}
+			}
+		})
+	}
+}
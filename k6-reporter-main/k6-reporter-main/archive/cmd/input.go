@@ -0,0 +1,228 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// How much of the input is looked at to detect its format
+const peekSize = 64 * 1024
+
+// Input formats, as given to -informat
+const (
+	formatAuto    = "auto"
+	formatSummary = "summary"
+	formatNDJSON  = "ndjson"
+	formatCSV     = "csv"
+)
+
+// inputOptions control how results are read and aggregated
+type inputOptions struct {
+	Format      string
+	TrendStats  []string
+	MetricTypes []metricDefinition        // Declared types for metrics the input doesn't describe itself
+	Submetrics  []string                  // Extra submetrics to compute from raw samples, e.g. http_req_duration{status:200}
+	Bucket      time.Duration             // Timeline bucket size, 0 to pick one from the length of the test
+	URLRules    *urlRules                 // How endpoint URLs are normalised, nil for the defaults
+	Scenarios   map[string]scenarioConfig // How scenarios were configured, from the -options file
+	SLORules    *sloRules                 // Apdex thresholds & SLOs requests are scored against, nil to not score them
+	Limits      capacityLimits            // Limits of the load levels of a stress test
+}
+
+// inputFlags are the command line flags controlling how results are read, shared by all commands
+type inputFlags struct {
+	format      *string
+	trendStats  *string
+	metricTypes *string
+	bucket      *time.Duration
+	urlRules    *string
+	optionsFile *string
+	sloRules    *string
+	p95Limit    *time.Duration
+	errorLimit  *float64
+}
+
+// addInputFlags adds the input flags to a flag set
+func addInputFlags(fs *flag.FlagSet) *inputFlags {
+	return &inputFlags{
+		format:      fs.String("informat", formatAuto, "Input format: auto, summary, ndjson or csv"),
+		trendStats:  fs.String("trendstats", defaultTrendStats, "Trend stats to compute from ndjson & csv input, e.g. avg,med,p(99),p(99.9)"),
+		metricTypes: fs.String("metrictypes", "", "Types of custom metrics in csv input, e.g. grpc_reqs=counter,queue_time=trend:time"),
+		bucket:      fs.Duration("bucket", 0, "Time bucket of the charts made from ndjson & csv input, e.g. 10s, 0 to pick one from the length of the test"),
+		urlRules:    fs.String("urlrules", "", "URL rule file, JSON with rewrites normalising the URLs of endpoints"),
+		optionsFile: fs.String("options", "", "K6 options file with the scenarios of the test, the output of k6 inspect"),
+		sloRules:    fs.String("slo", "", "SLO file, JSON with Apdex thresholds & SLOs to score ndjson & csv input against"),
+		p95Limit:    fs.Duration("p95limit", 0, "Highest P95 of http_req_duration a stress test can sustain, e.g. 800ms, 0 for no limit"),
+		errorLimit:  fs.Float64("errorlimit", 0.01, "Highest http_req_failed rate a stress test can sustain, e.g. 0.05, 0 for no limit"),
+	}
+}
+
+// options checks the input flags once they've been parsed
+func (f *inputFlags) options() (inputOptions, error) {
+	trendStats, err := parseTrendStats(*f.trendStats)
+	if err != nil {
+		return inputOptions{}, err
+	}
+	metricTypes, err := parseMetricTypes(*f.metricTypes)
+	if err != nil {
+		return inputOptions{}, err
+	}
+	if *f.bucket != 0 && *f.bucket < time.Second {
+		return inputOptions{}, fmt.Errorf("invalid bucket %s, the smallest is 1s", *f.bucket)
+	}
+	if *f.p95Limit < 0 || *f.errorLimit < 0 || *f.errorLimit >= 1 {
+		return inputOptions{}, fmt.Errorf("invalid limits, -p95limit can't be negative and -errorlimit must be a rate from 0 to 1")
+	}
+	opts := inputOptions{Format: *f.format, TrendStats: trendStats, MetricTypes: metricTypes, Bucket: *f.bucket}
+	opts.Limits = capacityLimits{P95: float64(*f.p95Limit) / float64(time.Millisecond), ErrorLimit: *f.errorLimit}
+	if *f.urlRules != "" {
+		if opts.URLRules, err = loadURLRules(*f.urlRules); err != nil {
+			return inputOptions{}, fmt.Errorf("URL rule file %s: %w", *f.urlRules, err)
+		}
+	}
+	if *f.optionsFile != "" {
+		if opts.Scenarios, err = loadScenarioOptions(*f.optionsFile); err != nil {
+			return inputOptions{}, fmt.Errorf("options file %s: %w", *f.optionsFile, err)
+		}
+	}
+	if *f.sloRules != "" {
+		if opts.SLORules, err = loadSLORules(*f.sloRules); err != nil {
+			return inputOptions{}, fmt.Errorf("SLO file %s: %w", *f.sloRules, err)
+		}
+	}
+	return opts, nil
+}
+
+// readResults loads a results file and works out everything derived from it, thresholds, check counts & title
+func readResults(filename string, opts inputOptions) (*ResultData, string, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, "", err
+	}
+	defer file.Close()
+
+	return decodeResults(file, titleFromFilename(filename), opts)
+}
+
+// decodeResults is readResults for results that aren't in a file, e.g. uploaded to the server
+func decodeResults(input io.Reader, title string, opts inputOptions) (*ResultData, string, error) {
+	resultData, formatName, err := loadResults(input, opts)
+	if err != nil {
+		return nil, "", err
+	}
+	completeResults(resultData, title)
+
+	return resultData, formatName, nil
+}
+
+// completeResults works out everything derived from loaded results
+func completeResults(resultData *ResultData, title string) {
+	resultData.Title = title
+
+	// Evaluate & count threshold failures/breaches
+	evaluateThresholds(resultData)
+
+	// Count check passes & failures, at every depth of the group tree
+	rollupGroup(&resultData.RootGroup)
+	resultData.CheckFailures = resultData.RootGroup.Fails
+	resultData.CheckPasses = resultData.RootGroup.Passes
+}
+
+// titleFromFilename is some simple transform of the input filename into a readable title
+func titleFromFilename(filename string) string {
+	title := filepath.Base(filename)
+	title = strings.ReplaceAll(title, ".json", "")
+	title = strings.ReplaceAll(title, ".csv", "")
+	title = strings.ReplaceAll(title, "_", " ")
+	return strings.Title(title)
+}
+
+// loadResults reads results in any supported input format, returning a description of the format
+func loadResults(input io.Reader, opts inputOptions) (*ResultData, string, error) {
+	reader := bufio.NewReaderSize(input, peekSize)
+	format := opts.Format
+	if format == formatAuto {
+		var err error
+		format, err = detectFormat(reader)
+		if err != nil {
+			return nil, "", err
+		}
+	}
+
+	switch format {
+	case formatSummary:
+		resultData, schema, err := decodeSummary(reader)
+		return resultData, schema.String() + " summary", err
+
+	case formatNDJSON:
+		agg, err := newInputAggregator(opts)
+		if err != nil {
+			return nil, "", err
+		}
+		if err := readNDJSON(reader, agg); err != nil {
+			return nil, "", err
+		}
+		return agg.result(), "NDJSON (--out json)", nil
+
+	case formatCSV:
+		agg, err := newInputAggregator(opts)
+		if err != nil {
+			return nil, "", err
+		}
+		if err := readCSV(reader, agg); err != nil {
+			return nil, "", err
+		}
+		return agg.result(), "CSV (--out csv)", nil
+	}
+
+	return nil, "", fmt.Errorf("unknown input format %q", format)
+}
+
+// detectFormat peeks at the first line of the input to work out what it is, without consuming it
+func detectFormat(reader *bufio.Reader) (string, error) {
+	head, err := reader.Peek(peekSize)
+	if err != nil && err != io.EOF && err != bufio.ErrBufferFull {
+		return "", err
+	}
+
+	firstLine := head
+	if i := bytes.IndexByte(head, '\n'); i >= 0 {
+		firstLine = head[:i]
+	}
+	if isNDJSON(firstLine) {
+		return formatNDJSON, nil
+	}
+	if isCSV(firstLine) {
+		return formatCSV, nil
+	}
+
+	return formatSummary, nil
+}
+
+// newInputAggregator creates an aggregator for the raw sample inputs, with any declared metric types
+func newInputAggregator(opts inputOptions) (*aggregator, error) {
+	agg := newAggregator(opts.TrendStats)
+	agg.bucket = opts.Bucket
+	agg.endpoints.rules = opts.URLRules
+	agg.scenarios.configs = opts.Scenarios
+	agg.scores.setRules(opts.SLORules)
+	agg.limits = opts.Limits
+	for _, def := range opts.MetricTypes {
+		if err := agg.addDefinition(def); err != nil {
+			return nil, err
+		}
+	}
+	for _, name := range opts.Submetrics {
+		if err := agg.addSubmetric(name); err != nil {
+			return nil, err
+		}
+	}
+	return agg, nil
+}
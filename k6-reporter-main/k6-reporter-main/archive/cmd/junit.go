@@ -0,0 +1,180 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+)
+
+// JUnit XML output, so CI test tabs can show thresholds & checks as individual test results
+// Thresholds all go into one suite, checks go into a suite per group, and SLOs scored with -slo into their own suite
+
+type junitTestSuites struct {
+	XMLName  xml.Name         `xml:"testsuites"`
+	Name     string           `xml:"name,attr"`
+	Tests    int              `xml:"tests,attr"`
+	Failures int              `xml:"failures,attr"`
+	Time     float64          `xml:"time,attr"`
+	Suites   []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name      string          `xml:"name,attr"`
+	Tests     int             `xml:"tests,attr"`
+	Failures  int             `xml:"failures,attr"`
+	TestCases []junitTestCase `xml:"testcase"`
+}
+
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	Classname string        `xml:"classname,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+	SystemOut string        `xml:"system-out,omitempty"`
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Type    string `xml:"type,attr"`
+	Text    string `xml:",chardata"`
+}
+
+// writeJUnit writes thresholds & checks of the results as JUnit XML
+func writeJUnit(filename string, resultData *ResultData) error {
+	suites := buildJUnit(resultData)
+
+	out, err := xml.MarshalIndent(suites, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filename, append([]byte(xml.Header), append(out, '\n')...), 0o644)
+}
+
+func buildJUnit(resultData *ResultData) junitTestSuites {
+	suites := junitTestSuites{
+		Name: resultData.Brand.Title,
+		Time: resultData.State.TestRunDurationMs / 1000,
+	}
+
+	thresholdSuite := junitTestSuite{Name: "thresholds"}
+	names := make([]string, 0, len(resultData.Metrics))
+	for name := range resultData.Metrics {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		metric := resultData.Metrics[name]
+		for _, thres := range metric.Thresholds {
+			testCase := junitTestCase{
+				Name:      fmt.Sprintf("%s: %s", name, thres.Source),
+				Classname: "thresholds." + name,
+			}
+
+			observed := "not available"
+			expr, value, ok, err := observedValue(metric, thres.Source)
+			if err == nil && ok {
+				observed = fmt.Sprintf("%s=%s", expr.SinkKey(), formatFloat(value))
+			}
+			testCase.SystemOut = "observed " + observed
+			if !thres.OK {
+				testCase.Failure = &junitFailure{
+					Message: fmt.Sprintf("threshold %q breached, observed %s", thres.Source, observed),
+					Type:    "threshold",
+					Text:    fmt.Sprintf("metric: %s\nthreshold: %s\nobserved: %s\n", name, thres.Source, observed),
+				}
+			}
+			thresholdSuite.add(testCase)
+		}
+	}
+	suites.add(thresholdSuite)
+
+	addCheckSuites(&suites, resultData.RootGroup)
+	suites.add(sloSuite(resultData))
+
+	return suites
+}
+
+// addCheckSuites adds a suite for the checks of a group, then for every group nested under it
+func addCheckSuites(suites *junitTestSuites, group Group) {
+	suiteName := "checks"
+	if group.Path != "" {
+		suiteName = "checks." + groupPathLabel(group.Path)
+	}
+
+	suite := junitTestSuite{Name: suiteName}
+	for _, check := range group.Checks {
+		testCase := junitTestCase{
+			Name:      check.Name,
+			Classname: suiteName,
+			SystemOut: fmt.Sprintf("%d passed, %d failed", check.Passes, check.Fails),
+		}
+		if check.Fails > 0 {
+			total := check.Passes + check.Fails
+			testCase.Failure = &junitFailure{
+				Message: fmt.Sprintf("check failed %d of %d times (%.2f%%)", check.Fails, total, 100*float64(check.Fails)/float64(total)),
+				Type:    "check",
+				Text:    fmt.Sprintf("group: %s\ncheck: %s\npasses: %d\nfails: %d\n", groupPathLabel(group.Path), check.Name, check.Passes, check.Fails),
+			}
+		}
+		suite.add(testCase)
+	}
+	suites.add(suite)
+
+	for _, subGroup := range group.Groups {
+		addCheckSuites(suites, subGroup)
+	}
+}
+
+// sloSuite has a test case for every SLO, and one for the Apdex score which fails when it's rated poor or worse
+func sloSuite(resultData *ResultData) junitTestSuite {
+	suite := junitTestSuite{Name: "slos"}
+	for _, slo := range resultData.SLOs {
+		observed := fmt.Sprintf("achieved %s%% of %s requests, %s%% of the error budget remaining",
+			formatFloat(slo.Achieved), formatFloat(slo.Requests), formatFloat(slo.BudgetRemaining*100))
+		testCase := junitTestCase{Name: slo.Name, Classname: "slos", SystemOut: observed}
+		if !slo.Met {
+			testCase.Failure = &junitFailure{
+				Message: fmt.Sprintf("SLO %q not met, %s", slo.Name, observed),
+				Type:    "slo",
+				Text:    fmt.Sprintf("slo: %s\ntarget: %s%%\nachieved: %s%%\nbudget remaining: %s%%\n", slo.Name, formatFloat(slo.Target), formatFloat(slo.Achieved), formatFloat(slo.BudgetRemaining*100)),
+			}
+		}
+		suite.add(testCase)
+	}
+	if apdex := resultData.Apdex; apdex != nil {
+		observed := fmt.Sprintf("score %s (%s), %s satisfied, %s tolerating, %s frustrated",
+			formatFloat(apdex.Score), apdex.Rating, formatFloat(apdex.Satisfied), formatFloat(apdex.Tolerating), formatFloat(apdex.Frustrated))
+		testCase := junitTestCase{Name: "apdex", Classname: "slos", SystemOut: observed}
+		if apdex.Score < 0.7 {
+			testCase.Failure = &junitFailure{Message: "Apdex " + observed, Type: "apdex", Text: observed + "\n"}
+		}
+		suite.add(testCase)
+	}
+	return suite
+}
+
+func (s *junitTestSuite) add(testCase junitTestCase) {
+	s.TestCases = append(s.TestCases, testCase)
+	s.Tests++
+	if testCase.Failure != nil {
+		s.Failures++
+	}
+}
+
+// add adds a suite, suites without any test cases are left out
+func (s *junitTestSuites) add(suite junitTestSuite) {
+	if suite.Tests == 0 {
+		return
+	}
+	s.Suites = append(s.Suites, suite)
+	s.Tests += suite.Tests
+	s.Failures += suite.Failures
+}
+
+// formatFloat formats a value with up to 4 decimal places, without trailing zeros
+// Enough for small rates like http_req_failed, without pages of digits for durations
+func formatFloat(value float64) string {
+	return strconv.FormatFloat(math.Round(value*10000)/10000, 'f', -1, 64)
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"encoding/xml"
+	"strings"
+	"testing"
+)
+
+func TestBuildJUnit(t *testing.T) {
+	resultData := &ResultData{
+		Metrics: map[string]Metric{
+			"http_req_duration": {Type: "trend", Values: map[string]float64{"p(95)": 612.3456789}, Thresholds: []Threshold{
+				{Source: "p(95)<500", OK: false},
+				{Source: "p(99)<900", OK: true},
+			}},
+		},
+		RootGroup: Group{
+			Checks: []Check{{Name: "is up", Passes: 10}},
+			Groups: []Group{{Name: "kasir", Path: "::kasir", Checks: []Check{{Name: "status is 200", Passes: 3, Fails: 1}}}},
+		},
+		SLOs:  []SLO{{Name: "fast", Target: 99, Requests: 100, Achieved: 97, BudgetRemaining: -2, Met: false}},
+		Apdex: &Apdex{Score: 0.96, Rating: "Excellent", Satisfied: 96, Frustrated: 4},
+		State: State{TestRunDurationMs: 90500},
+		Brand: Branding{Title: "Kasir"},
+	}
+	suites := buildJUnit(resultData)
+
+	if suites.Name != "Kasir" || suites.Time != 90.5 || suites.Tests != 6 || suites.Failures != 3 {
+		t.Errorf("got %s with %d tests, %d failures in %vs, want Kasir with 6, 3 in 90.5s", suites.Name, suites.Tests, suites.Failures, suites.Time)
+	}
+	names := []string{}
+	for _, suite := range suites.Suites {
+		names = append(names, suite.Name)
+	}
+	if got := strings.Join(names, ","); got != "thresholds,checks,checks.kasir,slos" {
+		t.Fatalf("got suites %s, want thresholds,checks,checks.kasir,slos", got)
+	}
+
+	tests := []struct {
+		name    string
+		test    junitTestCase
+		message string
+		out     string
+	}{
+		{"breached threshold", suites.Suites[0].TestCases[0], `threshold "p(95)<500" breached, observed p(95)=612.3457`, "observed p(95)=612.3457"},
+		{"threshold without the stat", suites.Suites[0].TestCases[1], "", "observed not available"},
+		{"passed check", suites.Suites[1].TestCases[0], "", "10 passed, 0 failed"},
+		{"failed check", suites.Suites[2].TestCases[0], "check failed 1 of 4 times (25.00%)", "3 passed, 1 failed"},
+		{"missed SLO", suites.Suites[3].TestCases[0], `SLO "fast" not met, achieved 97% of 100 requests, -200% of the error budget remaining`, "achieved 97% of 100 requests, -200% of the error budget remaining"},
+		{"excellent apdex", suites.Suites[3].TestCases[1], "", "score 0.96 (Excellent), 96 satisfied, 0 tolerating, 4 frustrated"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			message := ""
+			if test.test.Failure != nil {
+				message = test.test.Failure.Message
+			}
+			if message != test.message || test.test.SystemOut != test.out {
+				t.Errorf("got failure %q & output %q, want %q & %q", message, test.test.SystemOut, test.message, test.out)
+			}
+		})
+	}
+	if failure := suites.Suites[2].TestCases[0].Failure; failure.Type != "check" || failure.Text != "group: kasir\ncheck: status is 200\npasses: 3\nfails: 1\n" {
+		t.Errorf("got check failure %+v", failure)
+	}
+
+	out, err := xml.Marshal(suites)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `<failure message="threshold &#34;p(95)&lt;500&#34; breached, observed p(95)=612.3457" type="threshold">`; !strings.Contains(string(out), want) {
+		t.Errorf("got %s, want the failure escaped as %s", out, want)
+	}
+}
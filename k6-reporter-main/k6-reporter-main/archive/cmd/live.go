@@ -0,0 +1,259 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"html/template"
+	"io"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// The live command follows a K6 JSON output file while K6 is still writing it, like tail -F
+// Samples are aggregated as they arrive, and an auto refreshing report is rewritten every few seconds
+// The stream ends when nothing new has been written for a while, or on Ctrl+C, then the final report is written
+
+// How often the file is checked for new lines
+const livePollInterval = 500 * time.Millisecond
+
+// ndjsonTail follows a growing NDJSON file, through rotation & truncation
+type ndjsonTail struct {
+	filename string
+	file     *os.File
+	reader   *bufio.Reader
+	partial  []byte // Start of a line K6 is still writing
+	consumed int64  // Bytes read from the current file, including any partial line
+	lineNum  int
+	lines    int // Lines decoded since the start, across every file
+}
+
+// runLive is the live command
+func runLive(args []string) {
+	fs := flag.NewFlagSet("live", flag.ExitOnError)
+	var inFilename = fs.String("infile", "", "K6 JSON (--out json) output file to follow, it doesn't have to exist yet")
+	var outFilename = fs.String("outfile", "./out.html", "Output HTML filename, rewritten while the test runs")
+	var refresh = fs.Duration("refresh", 5*time.Second, "How often the report is rewritten, and reloaded in the browser")
+	var idle = fs.Duration("idle", time.Minute, "The stream has ended when nothing is written for this long, 0 to follow until interrupted")
+	var templatePath = fs.String("template", "", "HTML report template file, or directory of *.tmpl files, to override or extend the built in template")
+	var brandOpts = brandingOptions{}
+	addBrandingFlags(fs, &brandOpts, defaultTitlePattern)
+	var inFlags = addInputFlags(fs)
+	var localeFlags = addLocaleFlags(fs)
+	_ = fs.Parse(args)
+	if *inFilename == "" {
+		fmt.Printf("\n🚫 Input K6 JSON file not specified, please add -infile\n\n")
+		fs.PrintDefaults()
+		os.Exit(1)
+	}
+	if *refresh < time.Second {
+		fmt.Printf("\n🚫 The -refresh interval must be at least 1s\n\n")
+		os.Exit(1)
+	}
+
+	inOpts, err := inFlags.options()
+	if err != nil {
+		fmt.Println("💥 Input options error", err)
+		os.Exit(1)
+	}
+	if inOpts.Format != formatAuto && inOpts.Format != formatNDJSON {
+		fmt.Printf("\n🚫 Only ndjson input can be followed live\n\n")
+		os.Exit(1)
+	}
+	locale, zone, err := localeFlags.resolve()
+	if err != nil {
+		fmt.Println("💥 Locale error", err)
+		os.Exit(1)
+	}
+	tmpl, err := newReportTemplate(*templatePath, locale, zone)
+	if err != nil {
+		fmt.Println("💥 Template file error", err)
+		os.Exit(1)
+	}
+	agg, err := newInputAggregator(inOpts)
+	if err != nil {
+		fmt.Println("💥 Input options error", err)
+		os.Exit(1)
+	}
+
+	// Write the current state of the results, the live report reloads itself until the final one replaces it
+	writeReport := func(live bool) {
+		resultData := agg.result()
+		completeResults(resultData, titleFromFilename(*inFilename))
+		resultData.Generated = time.Now()
+		brand, err := newBranding(brandOpts, resultData.Title, resultData.Generated)
+		if err != nil {
+			fmt.Println("💥 Branding error", err)
+			os.Exit(1)
+		}
+		resultData.Brand = brand
+		view := newReportView(resultData, *inFilename, "NDJSON (--out json)")
+		if live {
+			view.Refresh = int(refresh.Seconds())
+		}
+		if err := writeLiveReport(*outFilename, tmpl, view); err != nil {
+			fmt.Println("💥 Output file error", err)
+			os.Exit(1)
+		}
+	}
+
+	tail := &ndjsonTail{filename: *inFilename}
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	poll := time.NewTicker(livePollInterval)
+	defer poll.Stop()
+	render := time.NewTicker(*refresh)
+	defer render.Stop()
+	lastData := time.Now()
+	written := 0
+
+	fmt.Printf("\n👀 Following %s, the report is rewritten every %s to: %s\n", *inFilename, *refresh, *outFilename)
+	for {
+		select {
+		case <-poll.C:
+			read, err := tail.follow(agg)
+			if err != nil {
+				fmt.Println("💥 Input file error", err)
+				os.Exit(1)
+			}
+			if read > 0 {
+				lastData = time.Now()
+			}
+			if *idle > 0 && tail.lines > 0 && time.Since(lastData) > *idle {
+				fmt.Printf("\n⏹️  Nothing written to %s for %s, the test has ended\n", *inFilename, *idle)
+				tail.flush(agg)
+				writeReport(false)
+				fmt.Printf("\n📜 Done! Final report of %d lines written to: %s\n", tail.lines, *outFilename)
+				return
+			}
+
+		case <-render.C:
+			if tail.lines > written {
+				writeReport(true)
+				written = tail.lines
+			}
+
+		case <-signals:
+			if _, err := tail.follow(agg); err != nil {
+				fmt.Println("💥 Input file error", err)
+				os.Exit(1)
+			}
+			tail.flush(agg)
+			if tail.lines == 0 {
+				fmt.Printf("\n🚫 Stopped before anything was written to %s\n\n", *inFilename)
+				os.Exit(1)
+			}
+			writeReport(false)
+			fmt.Printf("\n📜 Done! Final report of %d lines written to: %s\n", tail.lines, *outFilename)
+			return
+		}
+	}
+}
+
+// writeLiveReport renders the report to a temporary file first, so a browser never loads half a report
+func writeLiveReport(filename string, tmpl *template.Template, view ReportView) error {
+	page := &bytes.Buffer{}
+	if err := tmpl.Execute(page, view); err != nil {
+		return err
+	}
+	return writeFileAtomic(filename, page.Bytes())
+}
+
+// follow decodes any complete lines written since the last call, then checks if the file was rotated or truncated
+// The file is checked against the one that's open, so a replaced file is noticed whatever its size, and read straight away
+func (t *ndjsonTail) follow(agg *aggregator) (int, error) {
+	if t.file == nil {
+		file, err := os.Open(t.filename)
+		if os.IsNotExist(err) {
+			return 0, nil
+		}
+		if err != nil {
+			return 0, err
+		}
+		t.file, t.reader = file, bufio.NewReader(file)
+		t.partial, t.consumed, t.lineNum = nil, 0, 0
+	}
+
+	read, err := t.readLines(agg)
+	if err != nil {
+		return read, err
+	}
+
+	current, err := t.file.Stat()
+	if err != nil {
+		return read, err
+	}
+	info, err := os.Stat(t.filename)
+	switch {
+	case os.IsNotExist(err):
+		// Moved away and not recreated yet, keep reading the old file until it is
+	case err != nil:
+		return read, err
+	case !os.SameFile(info, current):
+		// Rotated, the rest of the old file was read above and K6 won't end its last line now
+		fmt.Printf("\n🔄 %s was rotated, following the new file\n", t.filename)
+		if t.flush(agg) {
+			read++
+		}
+		_ = t.file.Close()
+		t.file = nil
+		more, err := t.follow(agg)
+		return read + more, err
+	case info.Size() < t.consumed:
+		fmt.Printf("\n✂️  %s was truncated, reading it from the start\n", t.filename)
+		if _, err := t.file.Seek(0, io.SeekStart); err != nil {
+			return read, err
+		}
+		t.reader.Reset(t.file)
+		t.partial, t.consumed, t.lineNum = nil, 0, 0
+		more, err := t.readLines(agg)
+		return read + more, err
+	}
+	return read, nil
+}
+
+// readLines decodes complete lines until the end of what's been written so far
+// Lines that won't decode are skipped with a warning, rather than ending a long test's report
+func (t *ndjsonTail) readLines(agg *aggregator) (int, error) {
+	read := 0
+	for {
+		chunk, err := t.reader.ReadBytes('\n')
+		t.partial = append(t.partial, chunk...)
+		t.consumed += int64(len(chunk))
+		if errors.Is(err, io.EOF) {
+			return read, nil
+		}
+		if err != nil {
+			return read, err
+		}
+
+		if t.decode(agg) {
+			read++
+		}
+	}
+}
+
+// flush decodes a last line that was never ended with a newline, once the stream has ended
+func (t *ndjsonTail) flush(agg *aggregator) bool {
+	return len(t.partial) > 0 && t.decode(agg)
+}
+
+// decode decodes the line that's been read into the aggregator, reporting if it was a sample or definition
+func (t *ndjsonTail) decode(agg *aggregator) bool {
+	line := t.partial
+	t.partial = nil
+	t.lineNum++
+	if len(bytes.TrimSpace(line)) == 0 {
+		return false
+	}
+	if err := decodeNDJSONLine(fmt.Sprintf("line %d: $", t.lineNum), line, agg); err != nil {
+		fmt.Println("⚠️  Skipped", err)
+		return false
+	}
+	t.lines++
+	return true
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func appendFile(t *testing.T, filename, content string) {
+	t.Helper()
+	file, err := os.OpenFile(filename, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	if _, err := file.WriteString(content); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestNDJSONTail(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "results.json")
+	definition := `{"type":"Metric","data":{"name":"http_reqs","type":"counter"},"metric":"http_reqs"}` + "\n"
+	point := `{"type":"Point","data":{"time":"2021-01-08T12:00:00Z","value":1},"metric":"http_reqs"}`
+
+	agg := newAggregator(nil)
+	tail := &ndjsonTail{filename: filename}
+	follow := func(step string, want int) {
+		t.Helper()
+		read, err := tail.follow(agg)
+		if err != nil {
+			t.Fatalf("%s: %v", step, err)
+		}
+		if read != want {
+			t.Errorf("%s: got %d lines, want %d", step, read, want)
+		}
+	}
+
+	follow("not written yet", 0)
+	appendFile(t, filename, definition+point[:20])
+	follow("partial line", 1)
+	appendFile(t, filename, point[20:]+"\n"+point)
+	follow("line completed", 1)
+
+	// Replaced by a larger file, the last line of the old file is never ended
+	if err := os.Rename(filename, filename+".1"); err != nil {
+		t.Fatal(err)
+	}
+	appendFile(t, filename, definition+point+"\n"+point+"\n"+point+"\n")
+	follow("rotated", 5)
+
+	// Truncated & rewritten in place, smaller than what was read
+	if err := os.WriteFile(filename, []byte(definition), 0644); err != nil {
+		t.Fatal(err)
+	}
+	follow("truncated", 1)
+	appendFile(t, filename, point+"\n")
+	follow("after truncation", 1)
+
+	if tail.lines != 9 {
+		t.Errorf("got %d lines in all, want 9", tail.lines)
+	}
+	if count := agg.sinks["http_reqs"].count; count != 6 {
+		t.Errorf("got %d samples, want 6", count)
+	}
+}
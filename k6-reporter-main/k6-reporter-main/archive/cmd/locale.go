@@ -0,0 +1,460 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+	_ "time/tzdata" // Time zones are needed even in a scratch container
+)
+
+// Locale holds the translated labels and number & date formats of a language
+type Locale struct {
+	Code       string
+	Thousands  string // Thousands separator
+	Decimal    string // Decimal separator
+	TimeLayout string // Go time layout for timestamps
+	Labels     map[string]string
+}
+
+// Supported locales, labels missing from a locale fall back to English
+var locales = map[string]*Locale{
+	"en": {
+		Code:       "en",
+		Thousands:  ",",
+		Decimal:    ".",
+		TimeLayout: "02 Jan 2006 15:04:05 MST",
+		Labels: map[string]string{
+			"requests":             "Requests",
+			"breachedThresholds":   "Breached Thresholds",
+			"failedChecks":         "Failed Checks",
+			"average":              "Average",
+			"maximum":              "Maximum",
+			"median":               "Median",
+			"percentile":           "P%s",
+			"minimum":              "Minimum",
+			"metrics":              "Metrics",
+			"checks":               "Checks",
+			"passed":               "Passed",
+			"failed":               "Failed",
+			"iterations":           "Iterations",
+			"rate":                 "Rate",
+			"min":                  "Min",
+			"max":                  "Max",
+			"checksAndGroups":      "Checks & Groups",
+			"otherChecks":          "Other Checks",
+			"checkName":            "Check Name",
+			"passes":               "Passes",
+			"failures":             "Failures",
+			"testStart":            "Test Start",
+			"testEnd":              "Test End",
+			"duration":             "Duration",
+			"generated":            "Generated",
+			"timings":              "Timings",
+			"thresholds":           "Thresholds",
+			"metric":               "Metric",
+			"threshold":            "Threshold",
+			"aggregation":          "Aggregation",
+			"limit":                "Limit",
+			"observed":             "Observed",
+			"margin":               "Margin",
+			"abortOnFail":          "Abort on Fail",
+			"status":               "Status",
+			"baseline":             "Baseline",
+			"candidate":            "Candidate",
+			"tolerance":            "Tolerance",
+			"stat":                 "Stat",
+			"delta":                "Delta",
+			"change":               "Change",
+			"regressions":          "Regressions",
+			"warnings":             "Warnings",
+			"improvements":         "Improvements",
+			"groups":               "Groups",
+			"group":                "Group",
+			"unchanged":            "Unchanged",
+			"improved":             "Improved",
+			"warning":              "Warning",
+			"regressed":            "Regressed",
+			"changed":              "Changed",
+			"added":                "Added",
+			"removed":              "Removed",
+			"runs":                 "Runs",
+			"script":               "Script",
+			"environment":          "Environment",
+			"commit":               "Commit",
+			"label":                "Label",
+			"timestamp":            "Timestamp",
+			"p95Latency":           "P95 Latency",
+			"errorRate":            "Error Rate",
+			"rps":                  "Requests per Second",
+			"checkFailureRate":     "Check Failure Rate",
+			"filter":               "Filter",
+			"trend":                "Trend",
+			"compare":              "Compare",
+			"live":                 "● Live",
+			"charts":               "Charts",
+			"activeVUs":            "Active VUs",
+			"latency":              "Latency",
+			"checkPassRate":        "Check Pass Rate",
+			"endpoints":            "Endpoints",
+			"endpoint":             "Endpoint",
+			"method":               "Method",
+			"urls":                 "URLs",
+			"responses":            "Responses",
+			"statusClasses":        "Status Classes",
+			"statusClass":          "Class",
+			"statusCodes":          "Status Codes",
+			"errorCodes":           "Error Codes",
+			"errorCode":            "Error Code",
+			"description":          "Description",
+			"unexpected":           "Unexpected",
+			"errorsOverTime":       "Errors over Time",
+			"scenarios":            "Scenarios",
+			"scenario":             "Scenario",
+			"executor":             "Executor",
+			"iterationRate":        "Iterations per Second",
+			"configuration":        "Configuration",
+			"overall":              "Overall",
+			"total":                "Total",
+			"notRun":               "Not run",
+			"apdex":                "Apdex",
+			"apdexExcellent":       "Excellent",
+			"apdexGood":            "Good",
+			"apdexFair":            "Fair",
+			"apdexPoor":            "Poor",
+			"apdexUnacceptable":    "Unacceptable",
+			"apdexSatisfied":       "Satisfied",
+			"apdexTolerating":      "Tolerating",
+			"apdexFrustrated":      "Frustrated",
+			"slos":                 "SLOs",
+			"slosMet":              "SLOs Met",
+			"objective":            "Objective",
+			"achieved":             "Achieved",
+			"errorBudgetRemaining": "Error Budget Remaining",
+			"capacity":             "Capacity",
+			"load":                 "Load",
+			"knee":                 "Knee",
+			"sustainableCapacity":  "Sustainable Capacity",
+			"brokeAtLowestLoad":    "Broke at the lowest load",
+			"notBroken":            "Didn't break, the capacity is at least the highest load",
+			"knee_throughput":      "throughput stopped growing",
+			"knee_latency":         "P95 crossed the limit",
+			"knee_errors":          "error rate crossed the limit",
+			"latencyCorrelation":   "Load & P95 Correlation",
+			"errorCorrelation":     "Load & Error Rate Correlation",
+			"iterationsPerSecond":  "iterations/s",
+			"drift":                "Drift",
+			"steadyLoad":           "Steady Load",
+			"window":               "Window",
+			"comparedPeriods":      "First & Last Compared",
+			"degradedEndpoints":    "Degraded Endpoints",
+			"allRequests":          "All Requests",
+			"first":                "First",
+			"last":                 "Last",
+			"degraded":             "Degraded",
+			"stable":               "Stable",
+			"latencyDrift":         "P95 Drift",
+			"errorRateDrift":       "Error Rate Drift",
+			"throughputDrift":      "Throughput Drift",
+			"degradedEndpointsP95": "P95 of Degraded Endpoints",
+			"customMetrics":        "Custom Metrics",
+			"count":                "Total",
+			"value":                "Value",
+			"fails":                "Failures",
+
+			// Built in metrics, custom metrics are shown by their name
+			"vus":                      "Virtual Users",
+			"vus_max":                  "Max Virtual Users",
+			"http_reqs":                "Requests",
+			"http_req_failed":          "Failed Requests",
+			"http_req_duration":        "Duration",
+			"http_req_blocked":         "Blocked",
+			"http_req_connecting":      "Connecting",
+			"http_req_tls_handshaking": "TLS Handshaking",
+			"http_req_sending":         "Sending",
+			"http_req_waiting":         "Waiting",
+			"http_req_receiving":       "Receiving",
+			"iteration_duration":       "Iteration Duration",
+			"dropped_iterations":       "Dropped Iterations",
+			"group_duration":           "Group Duration",
+			"grpc_req_duration":        "gRPC Duration",
+			"data_received":            "Data Received",
+			"data_sent":                "Data Sent",
+		},
+	},
+	"id-ID": {
+		Code:       "id-ID",
+		Thousands:  ".",
+		Decimal:    ",",
+		TimeLayout: "02/01/2006 15.04.05 MST",
+		Labels: map[string]string{
+			"requests":             "Permintaan",
+			"breachedThresholds":   "Ambang Batas Terlampaui",
+			"failedChecks":         "Pemeriksaan Gagal",
+			"average":              "Rata-rata",
+			"maximum":              "Maksimum",
+			"median":               "Median",
+			"percentile":           "P%s",
+			"minimum":              "Minimum",
+			"metrics":              "Metrik",
+			"checks":               "Pemeriksaan",
+			"passed":               "Lulus",
+			"failed":               "Gagal",
+			"iterations":           "Iterasi",
+			"rate":                 "Laju",
+			"min":                  "Min",
+			"max":                  "Maks",
+			"checksAndGroups":      "Pemeriksaan & Grup",
+			"otherChecks":          "Pemeriksaan Lainnya",
+			"checkName":            "Nama Pemeriksaan",
+			"passes":               "Lulus",
+			"failures":             "Gagal",
+			"testStart":            "Mulai Tes",
+			"testEnd":              "Selesai Tes",
+			"duration":             "Durasi",
+			"generated":            "Dibuat",
+			"timings":              "Waktu",
+			"thresholds":           "Ambang Batas",
+			"metric":               "Metrik",
+			"threshold":            "Ambang Batas",
+			"aggregation":          "Agregasi",
+			"limit":                "Batas",
+			"observed":             "Teramati",
+			"margin":               "Selisih",
+			"abortOnFail":          "Hentikan Jika Gagal",
+			"status":               "Status",
+			"baseline":             "Acuan",
+			"candidate":            "Kandidat",
+			"tolerance":            "Toleransi",
+			"stat":                 "Statistik",
+			"delta":                "Selisih",
+			"change":               "Perubahan",
+			"regressions":          "Regresi",
+			"warnings":             "Peringatan",
+			"improvements":         "Perbaikan",
+			"groups":               "Grup",
+			"group":                "Grup",
+			"unchanged":            "Tidak Berubah",
+			"improved":             "Membaik",
+			"warning":              "Peringatan",
+			"regressed":            "Memburuk",
+			"changed":              "Berubah",
+			"added":                "Ditambah",
+			"removed":              "Dihapus",
+			"runs":                 "Eksekusi",
+			"script":               "Skrip",
+			"environment":          "Lingkungan",
+			"commit":               "Commit",
+			"label":                "Label",
+			"timestamp":            "Waktu",
+			"p95Latency":           "Latensi P95",
+			"errorRate":            "Tingkat Galat",
+			"rps":                  "Permintaan per Detik",
+			"checkFailureRate":     "Tingkat Pemeriksaan Gagal",
+			"filter":               "Saring",
+			"trend":                "Tren",
+			"compare":              "Bandingkan",
+			"live":                 "● Langsung",
+			"charts":               "Grafik",
+			"activeVUs":            "VU Aktif",
+			"latency":              "Latensi",
+			"checkPassRate":        "Tingkat Pemeriksaan Lulus",
+			"endpoints":            "Endpoint",
+			"endpoint":             "Endpoint",
+			"method":               "Metode",
+			"urls":                 "URL",
+			"responses":            "Respons",
+			"statusClasses":        "Kelas Status",
+			"statusClass":          "Kelas",
+			"statusCodes":          "Kode Status",
+			"errorCodes":           "Kode Kesalahan",
+			"errorCode":            "Kode Kesalahan",
+			"description":          "Deskripsi",
+			"unexpected":           "Tidak Diharapkan",
+			"errorsOverTime":       "Kesalahan dari Waktu ke Waktu",
+			"scenarios":            "Skenario",
+			"scenario":             "Skenario",
+			"executor":             "Eksekutor",
+			"iterationRate":        "Iterasi per Detik",
+			"configuration":        "Konfigurasi",
+			"overall":              "Keseluruhan",
+			"total":                "Total",
+			"notRun":               "Tidak dijalankan",
+			"apdex":                "Apdex",
+			"apdexExcellent":       "Sangat Baik",
+			"apdexGood":            "Baik",
+			"apdexFair":            "Cukup",
+			"apdexPoor":            "Buruk",
+			"apdexUnacceptable":    "Tidak Dapat Diterima",
+			"apdexSatisfied":       "Puas",
+			"apdexTolerating":      "Toleransi",
+			"apdexFrustrated":      "Frustrasi",
+			"slos":                 "SLO",
+			"slosMet":              "SLO Terpenuhi",
+			"objective":            "Sasaran",
+			"achieved":             "Tercapai",
+			"errorBudgetRemaining": "Sisa Anggaran Kesalahan",
+			"capacity":             "Kapasitas",
+			"load":                 "Beban",
+			"knee":                 "Titik Patah",
+			"sustainableCapacity":  "Kapasitas Berkelanjutan",
+			"brokeAtLowestLoad":    "Gagal pada beban terendah",
+			"notBroken":            "Tidak gagal, kapasitas setidaknya beban tertinggi",
+			"knee_throughput":      "throughput berhenti naik",
+			"knee_latency":         "P95 melewati batas",
+			"knee_errors":          "tingkat kesalahan melewati batas",
+			"latencyCorrelation":   "Korelasi Beban & P95",
+			"errorCorrelation":     "Korelasi Beban & Tingkat Kesalahan",
+			"iterationsPerSecond":  "iterasi/dtk",
+			"drift":                "Pergeseran",
+			"steadyLoad":           "Beban Stabil",
+			"window":               "Jendela",
+			"comparedPeriods":      "Awal & Akhir Dibandingkan",
+			"degradedEndpoints":    "Endpoint Menurun",
+			"allRequests":          "Semua Permintaan",
+			"first":                "Awal",
+			"last":                 "Akhir",
+			"degraded":             "Menurun",
+			"stable":               "Stabil",
+			"latencyDrift":         "Pergeseran P95",
+			"errorRateDrift":       "Pergeseran Tingkat Galat",
+			"throughputDrift":      "Pergeseran Throughput",
+			"degradedEndpointsP95": "P95 Endpoint yang Menurun",
+			"customMetrics":        "Metrik Kustom",
+			"count":                "Total",
+			"value":                "Nilai",
+			"fails":                "Gagal",
+
+			// Built in metrics, custom metrics are shown by their name
+			"vus":                      "Pengguna Virtual",
+			"vus_max":                  "Maks Pengguna Virtual",
+			"http_reqs":                "Permintaan",
+			"http_req_failed":          "Permintaan Gagal",
+			"http_req_duration":        "Durasi",
+			"http_req_blocked":         "Terblokir",
+			"http_req_connecting":      "Menghubungkan",
+			"http_req_tls_handshaking": "TLS Handshaking",
+			"http_req_sending":         "Mengirim",
+			"http_req_waiting":         "Menunggu",
+			"http_req_receiving":       "Menerima",
+			"iteration_duration":       "Durasi Iterasi",
+			"dropped_iterations":       "Iterasi Terbuang",
+			"group_duration":           "Durasi Grup",
+			"grpc_req_duration":        "Durasi gRPC",
+			"data_received":            "Data Diterima",
+			"data_sent":                "Data Dikirim",
+		},
+	},
+}
+
+// Other names people might use for the supported locales
+var localeAliases = map[string]string{
+	"en-US": "en",
+	"en-GB": "en",
+	"id":    "id-ID",
+}
+
+// localeFlags are the command line flags for the language & time zone of reports
+type localeFlags struct {
+	code *string
+	zone *string
+}
+
+// addLocaleFlags adds the locale flags to a flag set
+func addLocaleFlags(fs *flag.FlagSet) *localeFlags {
+	return &localeFlags{
+		code: fs.String("locale", "en", "Language & number format of the HTML report: en or id-ID"),
+		zone: fs.String("tz", "Local", "Time zone of timestamps in the HTML report, e.g. Asia/Jakarta"),
+	}
+}
+
+// resolve finds the locale & loads the time zone once the flags have been parsed
+func (f *localeFlags) resolve() (*Locale, *time.Location, error) {
+	locale, err := findLocale(*f.code)
+	if err != nil {
+		return nil, nil, err
+	}
+	zone, err := time.LoadLocation(*f.zone)
+	if err != nil {
+		return nil, nil, err
+	}
+	return locale, zone, nil
+}
+
+// findLocale looks up a locale by its code, e.g. "id-ID"
+func findLocale(code string) (*Locale, error) {
+	if alias, ok := localeAliases[code]; ok {
+		code = alias
+	}
+	locale, ok := locales[code]
+	if !ok {
+		return nil, fmt.Errorf("unsupported locale %q, use en or id-ID", code)
+	}
+	return locale, nil
+}
+
+// T translates a label
+func (l *Locale) T(key string) string {
+	if label, ok := l.Labels[key]; ok {
+		return label
+	}
+	if label, ok := locales["en"].Labels[key]; ok {
+		return label
+	}
+	return key
+}
+
+// FormatNumber formats a number with the locale's separators, e.g. 4.251,5 for id-ID
+func (l *Locale) FormatNumber(value float64, decimals int) string {
+	if math.IsNaN(value) || math.IsInf(value, 0) {
+		return strconv.FormatFloat(value, 'f', -1, 64)
+	}
+
+	text := strconv.FormatFloat(value, 'f', decimals, 64)
+	sign := ""
+	if strings.HasPrefix(text, "-") {
+		sign, text = "-", text[1:]
+	}
+	whole, fraction := text, ""
+	if i := strings.Index(text, "."); i >= 0 {
+		whole, fraction = text[:i], text[i+1:]
+	}
+
+	grouped := &strings.Builder{}
+	for i, digit := range whole {
+		if i > 0 && (len(whole)-i)%3 == 0 {
+			grouped.WriteString(l.Thousands)
+		}
+		grouped.WriteRune(digit)
+	}
+
+	if fraction != "" {
+		return sign + grouped.String() + l.Decimal + fraction
+	}
+	return sign + grouped.String()
+}
+
+// FormatTime formats a timestamp in the given time zone
+func (l *Locale) FormatTime(t time.Time, zone *time.Location) string {
+	if t.IsZero() {
+		return "-"
+	}
+	return t.In(zone).Format(l.TimeLayout)
+}
+
+// toFloat converts the numbers found in templates, anything else is zero
+func toFloat(value interface{}) float64 {
+	switch v := value.(type) {
+	case float64:
+		return v
+	case float32:
+		return float64(v)
+	case int:
+		return float64(v)
+	case int64:
+		return float64(v)
+	}
+	return 0
+}
@@ -3,15 +3,11 @@ package main
 
 import (
 	_ "embed"
-	"encoding/json"
 	"flag"
 	"fmt"
-	"html/template"
 	"os"
-	"path/filepath"
-	"strings"
-
-	"github.com/Masterminds/sprig/v3"
+	"time"
+	"unicode/utf8"
 )
 
 // ResultData is our main data struct (the input K6 JSON)
@@ -19,31 +15,80 @@ type ResultData struct {
 	Title             string
 	ThresholdFailures int
 	ThresholdTotal    int
+	Thresholds        []ThresholdResult `json:"-"` // Every threshold of every metric, sorted by metric name
 	CheckFailures     int
 	CheckPasses       int
-	Metrics           map[string]interface{}
-	RootGroup         RootGroup `json:"root_group"`
+	Metrics           map[string]Metric
+	RootGroup         Group `json:"root_group"`
+	Options           Options
+	State             State
+
+	// Results only known from inputs with raw samples (ndjson & csv), a summary doesn't have them
+	Timeline  *Timeline  `json:",omitempty"`
+	Endpoints []Endpoint `json:",omitempty"`
+	Responses *Responses `json:",omitempty"`
+	Scenarios []Scenario `json:",omitempty"`
+	Apdex     *Apdex     `json:",omitempty"` // When scored with -slo
+	SLOs      []SLO      `json:",omitempty"` // When scored with -slo
+	Capacity  *Capacity  `json:",omitempty"` // When the load ramped
+	Drift     *Drift     `json:",omitempty"` // When there was a long enough steady load
+
+	Brand     Branding  `json:"-"`
+	Generated time.Time `json:"-"` // When the report was made
+}
+
+// Metric is a single K6 metric, or submetric e.g. http_req_duration{expected_response:true}
+type Metric struct {
+	Name       string
+	Type       string             // One of counter, gauge, rate or trend
+	Contains   string             // One of default, time or data
+	Values     map[string]float64 // Keyed by stat name, e.g. "avg", "p(95)", "count", "rate"
+	Thresholds []Threshold
 }
 
-// RootGroup hold all groups
-type RootGroup struct {
-	Groups map[string]Group
-	Checks map[string]Check
+// Threshold is a single threshold expression set on a metric, e.g. "p(95)<500"
+// AbortOnFail is only known from K6 JSON output, the summary doesn't include it
+type Threshold struct {
+	Source      string
+	OK          bool
+	AbortOnFail bool `json:",omitempty"`
 }
 
-// Group is a single group
+// Group is a single group, the root group holds all other groups
+// Passes & Fails are rolled up from the checks of this group and all groups nested under it
 type Group struct {
 	Name   string
-	Checks map[string]Check
+	Path   string
+	ID     string
+	Groups []Group
+	Checks []Check
+	Passes int `json:"-"`
+	Fails  int `json:"-"`
 }
 
 // Check is under a group
 type Check struct {
 	Name   string
+	Path   string
+	ID     string
 	Passes int
 	Fails  int
 }
 
+// Options holds the summary related K6 options used for the test run
+type Options struct {
+	SummaryTrendStats []string `json:"summaryTrendStats"`
+	SummaryTimeUnit   string   `json:"summaryTimeUnit"`
+}
+
+// State holds details of the test run itself
+// Start & end times are only known when reading raw samples, a summary doesn't include them
+type State struct {
+	TestRunDurationMs float64   `json:"testRunDurationMs"`
+	StartTime         time.Time `json:"-"`
+	EndTime           time.Time `json:"-"`
+}
+
 //go:embed "templates/report.tmpl"
 var templateString string
 var version = "1.2.0" // App version number, set at build time
@@ -53,8 +98,40 @@ func main() {
 	fmt.Printf("║   \033[33m🗻 K6 HTML Report Converter 📜\033[36m   \033[35mv%s  \033[36m║\n", version)
 	fmt.Println("╚════════════════════════════════════════════╝\033[0m")
 
-	var inFilename = flag.String("infile", "", "K6 JSON result summary file")
-	var outFilename = flag.String("outfile", "./out.html", "Output HTML filename")
+	// Commands other than the default of converting a single result file
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "compare":
+			runCompare(os.Args[2:])
+			return
+		case "gate":
+			runGate(os.Args[2:])
+			return
+		case "history":
+			runHistory(os.Args[2:])
+			return
+		case "serve":
+			runServe(os.Args[2:])
+			return
+		case "live":
+			runLive(os.Args[2:])
+			return
+		}
+	}
+
+	var inFilename = flag.String("infile", "", "K6 JSON result summary file, or K6 JSON (--out json) or CSV (--out csv) output file")
+	var outFilename = flag.String("outfile", "./out.html", "Output HTML filename, set to empty to skip the HTML report")
+	var junitFilename = flag.String("junit", "", "Output JUnit XML filename, thresholds & checks as test cases")
+	var markdownFilename = flag.String("markdown", "", "Output Markdown filename, a compact report for merge request comments")
+	var markdownRows = flag.Int("mdrows", 50, "Maximum rows in each Markdown checks table, 0 for no limit")
+	var markdownLimit = flag.Int("mdlimit", 65536, "Maximum size of the Markdown report in characters, 0 for no limit")
+	var templatePath = flag.String("template", "", "HTML report template file, or directory of *.tmpl files, to override or extend the built in template")
+	var historyDir = flag.String("history", "", "Directory of a history store to add the run to, for trends across runs")
+	var brandOpts = brandingOptions{}
+	addBrandingFlags(flag.CommandLine, &brandOpts, defaultTitlePattern)
+	var inFlags = addInputFlags(flag.CommandLine)
+	var runOpts = addRunFlags(flag.CommandLine)
+	var localeFlags = addLocaleFlags(flag.CommandLine)
 	flag.Parse()
 	if *inFilename == "" {
 		fmt.Printf("\n🚫 Input K6 JSON file not specified, please add -infile\n\n")
@@ -62,66 +139,78 @@ func main() {
 		os.Exit(1)
 	}
 
-	tmpl, err := template.New("").Funcs(sprig.FuncMap()).Parse(templateString)
+	if *markdownLimit != 0 && *markdownLimit < utf8.RuneCountInString(markdownTruncatedNote) {
+		fmt.Printf("💥 Markdown options error -mdlimit %d is too small, it must be 0 or at least %d\n", *markdownLimit, utf8.RuneCountInString(markdownTruncatedNote))
+		os.Exit(1)
+	}
+
+	inOpts, err := inFlags.options()
+	if err != nil {
+		fmt.Println("💥 Input options error", err)
+		os.Exit(1)
+	}
+	locale, zone, err := localeFlags.resolve()
+	if err != nil {
+		fmt.Println("💥 Locale error", err)
+		os.Exit(1)
+	}
+
+	tmpl, err := newReportTemplate(*templatePath, locale, zone)
 	if err != nil {
 		fmt.Println("💥 Template file error", err)
 		os.Exit(1)
 	}
 
-	// Open input results JSON
-	resultFile, err := os.Open(*inFilename)
+	// Open input results and decode into our data struct
+	resultData, formatName, err := readResults(*inFilename, inOpts)
 	if err != nil {
 		fmt.Println("💥 Input file error", err)
 		os.Exit(1)
 	}
-	resultData := ResultData{}
-	_ = json.NewDecoder(resultFile).Decode(&resultData)
-	// Ignore errors for good reason, metrics key holds a mix of stuff
+	fmt.Printf("\n📂 Read %s from: %s\n", formatName, *inFilename)
 
-	// Open output HTML file
-	outFile, err := os.Create(*outFilename)
+	resultData.Generated = time.Now()
+	resultData.Brand, err = newBranding(brandOpts, resultData.Title, resultData.Generated)
 	if err != nil {
-		fmt.Println("💥 Output file error", err)
+		fmt.Println("💥 Branding error", err)
 		os.Exit(1)
 	}
 
-	// Some simple transform of the input filename into a readable title
-	resultData.Title = filepath.Base(*inFilename)
-	resultData.Title = strings.ReplaceAll(resultData.Title, ".json", "")
-	resultData.Title = strings.ReplaceAll(resultData.Title, "_", " ")
-	resultData.Title = strings.Title(resultData.Title)
-
-	// Count threshold failures/breaches
-	thresholdFailures := 0
-	thresholdTotal := 0
-	for _, metric := range resultData.Metrics {
-		metricMap := metric.(map[string]interface{})
-		if metricMap["thresholds"] != nil {
-			thresholds := metricMap["thresholds"].(map[string]interface{})
-			thresholdTotal++
-			for _, thres := range thresholds {
-				if thres.(bool) {
-					thresholdFailures++
-				}
-			}
+	if *junitFilename != "" {
+		if err := writeJUnit(*junitFilename, resultData); err != nil {
+			fmt.Println("💥 JUnit output error", err)
+			os.Exit(1)
 		}
+		fmt.Printf("\n🧪 JUnit XML written to: %s\n", *junitFilename)
 	}
-	resultData.ThresholdFailures = thresholdFailures
-	resultData.ThresholdTotal = thresholdTotal
-
-	// Count threshold failures/breaches
-	checkFailures := 0
-	checkPasses := 0
-	for _, group := range resultData.RootGroup.Groups {
-		for _, check := range group.Checks {
-			checkFailures += check.Fails
-			checkPasses += check.Passes
+
+	if *markdownFilename != "" {
+		if err := writeMarkdown(*markdownFilename, resultData, *markdownRows, *markdownLimit); err != nil {
+			fmt.Println("💥 Markdown output error", err)
+			os.Exit(1)
 		}
+		fmt.Printf("\n📝 Markdown written to: %s\n", *markdownFilename)
+	}
+
+	if *historyDir != "" {
+		storeRun(*historyDir, runOpts.run(resultData, *inFilename, formatName), resultData)
+	}
+
+	if *outFilename == "" {
+		return
 	}
-	resultData.CheckFailures = checkFailures
-	resultData.CheckPasses = checkPasses
 
+	// Open output HTML file
+	outFile, err := os.Create(*outFilename)
+	if err != nil {
+		fmt.Println("💥 Output file error", err)
+		os.Exit(1)
+	}
+
+	// Render template into output file, and that's it
+	if err := tmpl.Execute(outFile, newReportView(resultData, *inFilename, formatName)); err != nil {
+		fmt.Println("💥 Template error", err)
+		os.Exit(1)
+	}
 	fmt.Printf("\n📜 Done! Output HTML written to: %s\n", outFile.Name())
-	// Render template into output fine, and that's it
-	_ = tmpl.Execute(outFile, resultData)
 }
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"bytes"
+	_ "embed"
+	"os"
+	"sort"
+	"strings"
+	"text/template"
+	"time"
+	"unicode/utf8"
+
+	"github.com/Masterminds/sprig/v3"
+)
+
+// Markdown output, a compact version of the report for pasting into merge request comments
+// Comment size is limited (GitHub allows 65536 characters), so to stay inside the limit:
+//  - the failed checks table, and the checks of each group, are cut to the most failed rows
+//  - if still too long the collapsible group sections are left out
+//  - if that's still not enough, the output is cut at the limit with a note saying so
+
+//go:embed "templates/report.md.tmpl"
+var markdownTemplateString string
+
+// Appended when the Markdown is cut short
+const markdownTruncatedNote = "\n\n_…report truncated to fit the size limit_\n"
+
+// markdownView is the data the Markdown template is rendered with
+type markdownView struct {
+	*ResultData
+	TrendStats         []string
+	TrendMetrics       []Metric
+	BreachedThresholds []breachedThreshold
+	FailedChecks       []groupCheck
+	OmittedChecks      int
+	ShowGroups         bool
+	MaxRows            int
+}
+
+// breachedThreshold is a failed threshold along with the value that breached it
+type breachedThreshold struct {
+	Metric   string
+	Source   string
+	Observed string
+}
+
+// groupCheck is a check along with the readable path of the group it's in
+type groupCheck struct {
+	Check
+	Group string
+}
+
+// writeMarkdown renders the results as Markdown, keeping within limit characters
+func writeMarkdown(filename string, resultData *ResultData, maxRows, limit int) error {
+	out, err := renderMarkdown(resultData, maxRows, limit)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filename, []byte(out), 0o644)
+}
+
+func renderMarkdown(resultData *ResultData, maxRows, limit int) (string, error) {
+	tmpl, err := template.New("").Funcs(sprig.TxtFuncMap()).Funcs(template.FuncMap{
+		"mdEscape":    markdownEscape,
+		"fmtNum":      formatFloat,
+		"fmtStat":     markdownStat,
+		"msDuration":  msDuration,
+		"metricValue": metricValue,
+		"statFailed":  statFailed,
+		"headChecks":  headChecks,
+	}).Parse(markdownTemplateString)
+	if err != nil {
+		return "", err
+	}
+
+	view := markdownView{
+		ResultData: resultData,
+		TrendStats: trendStatColumns(resultData),
+		ShowGroups: true,
+		MaxRows:    maxRows,
+	}
+	for _, name := range sortedMetricNames(resultData.Metrics) {
+		metric := resultData.Metrics[name]
+		if metric.Type == "trend" {
+			view.TrendMetrics = append(view.TrendMetrics, metric)
+		}
+		for _, thres := range metric.Thresholds {
+			if thres.OK {
+				continue
+			}
+			breached := breachedThreshold{Metric: name, Source: thres.Source}
+			if expr, value, ok, err := observedValue(metric, thres.Source); err == nil && ok {
+				breached.Observed = expr.SinkKey() + "=" + formatFloat(value)
+			}
+			view.BreachedThresholds = append(view.BreachedThresholds, breached)
+		}
+	}
+
+	failedChecks := []groupCheck{}
+	collectFailedChecks(resultData.RootGroup, &failedChecks)
+	sort.SliceStable(failedChecks, func(i, j int) bool {
+		return failedChecks[i].Fails > failedChecks[j].Fails
+	})
+	view.FailedChecks = headGroupChecks(failedChecks, maxRows)
+	view.OmittedChecks = len(failedChecks) - len(view.FailedChecks)
+
+	out := &bytes.Buffer{}
+	if err := tmpl.Execute(out, view); err != nil {
+		return "", err
+	}
+	if limit <= 0 || utf8.RuneCount(out.Bytes()) <= limit {
+		return out.String(), nil
+	}
+
+	view.ShowGroups = false
+	out.Reset()
+	if err := tmpl.Execute(out, view); err != nil {
+		return "", err
+	}
+	return truncateMarkdown(out.String(), limit), nil
+}
+
+// truncateMarkdown cuts Markdown to limit characters, at the end of a line where there is one, and adds a note saying so
+// A limit too small for the note gives just the note, -mdlimit doesn't allow that
+func truncateMarkdown(markdown string, limit int) string {
+	if utf8.RuneCountInString(markdown) <= limit {
+		return markdown
+	}
+	keep := limit - utf8.RuneCountInString(markdownTruncatedNote)
+	if keep <= 0 {
+		return markdownTruncatedNote
+	}
+	// Cut at the byte offset of the first character that doesn't fit, so a multibyte character is never split
+	end := 0
+	for i := 0; i < keep; i++ {
+		_, size := utf8.DecodeRuneInString(markdown[end:])
+		end += size
+	}
+	cut := markdown[:end]
+	if i := strings.LastIndex(cut, "\n"); i > 0 {
+		cut = cut[:i]
+	}
+	return cut + markdownTruncatedNote
+}
+
+// collectFailedChecks gathers every check with failures, from a group and all groups nested under it
+func collectFailedChecks(group Group, checks *[]groupCheck) {
+	label := groupPathLabel(group.Path)
+	if label == "" {
+		label = "(root)"
+	}
+	for _, check := range group.Checks {
+		if check.Fails > 0 {
+			*checks = append(*checks, groupCheck{Check: check, Group: label})
+		}
+	}
+	for _, subGroup := range group.Groups {
+		collectFailedChecks(subGroup, checks)
+	}
+}
+
+// headChecks returns up to max checks, the most failed ones when there are more
+func headChecks(checks []Check, max int) []Check {
+	if max > 0 && len(checks) > max {
+		sorted := append([]Check{}, checks...)
+		sort.SliceStable(sorted, func(i, j int) bool {
+			return sorted[i].Fails > sorted[j].Fails
+		})
+		return sorted[:max]
+	}
+	return checks
+}
+
+func headGroupChecks(checks []groupCheck, max int) []groupCheck {
+	if max > 0 && len(checks) > max {
+		return checks[:max]
+	}
+	return checks
+}
+
+// markdownEscape stops names from breaking out of table cells
+func markdownEscape(text string) string {
+	return strings.NewReplacer("|", "\\|", "\n", " ", "\r", "", "<", "&lt;", ">", "&gt;").Replace(text)
+}
+
+// msDuration formats a number of milliseconds as a readable duration, e.g. 1m0.99s
+func msDuration(ms float64) string {
+	return time.Duration(ms * float64(time.Millisecond)).Round(10 * time.Millisecond).String()
+}
+
+// markdownStat formats a stat of a metric, or "-" if the metric doesn't have it
+func markdownStat(metric Metric, stat string) string {
+	value, ok := metric.Values[stat]
+	if !ok {
+		return "-"
+	}
+	return formatFloat(value)
+}
+
+// metricValue gets a single stat of a metric, or zero if the metric or stat isn't there
+func metricValue(metrics map[string]Metric, name, stat string) float64 {
+	return metrics[name].Values[stat]
+}
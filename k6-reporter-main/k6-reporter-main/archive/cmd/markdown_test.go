@@ -0,0 +1,98 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestTruncateMarkdown(t *testing.T) {
+	note := utf8.RuneCountInString(markdownTruncatedNote)
+	lines := "# Report\n\n" + strings.Repeat("| status is 200 | 100% |\n", 10)
+	multibyte := strings.Repeat("é🚀…", 50)
+
+	tests := []struct {
+		name     string
+		markdown string
+		limit    int
+		want     string
+	}{
+		{"within limit", lines, 1000, lines},
+		{"limit of 1", lines, 1, markdownTruncatedNote},
+		{"limit of the note", lines, note, markdownTruncatedNote},
+		{"cut at a line end", lines, note + 14, "# Report\n" + markdownTruncatedNote},
+		{"cut between multibyte characters", multibyte, note + 4, "é🚀…é" + markdownTruncatedNote},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := truncateMarkdown(test.markdown, test.limit)
+			if got != test.want {
+				t.Errorf("got %q, want %q", got, test.want)
+			}
+			if !utf8.ValidString(got) {
+				t.Errorf("got invalid UTF-8 %q", got)
+			}
+			if test.limit >= note && utf8.RuneCountInString(got) > test.limit {
+				t.Errorf("got %d characters, more than the limit of %d", utf8.RuneCountInString(got), test.limit)
+			}
+		})
+	}
+}
+
+func TestRenderMarkdownSmallLimit(t *testing.T) {
+	resultData := &ResultData{Title: "Test 🚀…", Metrics: map[string]Metric{}}
+	for _, limit := range []int{1, utf8.RuneCountInString(markdownTruncatedNote), 60} {
+		out, err := renderMarkdown(resultData, 50, limit)
+		if err != nil {
+			t.Fatalf("limit %d: %v", limit, err)
+		}
+		if !utf8.ValidString(out) {
+			t.Errorf("limit %d: invalid UTF-8 %q", limit, out)
+		}
+	}
+}
+
+func TestHeadChecks(t *testing.T) {
+	checks := []Check{{Name: "a", Fails: 1}, {Name: "b", Fails: 0}, {Name: "c", Fails: 5}, {Name: "d", Fails: 3}}
+
+	tests := []struct {
+		name string
+		max  int
+		want string
+	}{
+		{"no limit", 0, "abcd"},
+		{"within limit", 4, "abcd"},
+		{"most failed", 2, "cd"},
+		{"ties in order", 3, "cda"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := ""
+			for _, check := range headChecks(checks, test.max) {
+				got += check.Name
+			}
+			if got != test.want {
+				t.Errorf("got %s, want %s", got, test.want)
+			}
+		})
+	}
+	if checks[0].Name != "a" || checks[2].Name != "c" {
+		t.Errorf("got checks reordered %+v, want them untouched", checks)
+	}
+}
+
+func TestRenderMarkdownMissingStat(t *testing.T) {
+	resultData := &ResultData{
+		Metrics: map[string]Metric{
+			"http_req_duration": {Name: "http_req_duration", Type: "trend", Contains: "time", Values: map[string]float64{"avg": 0, "p(95)": 250.5}},
+		},
+		Options: Options{SummaryTrendStats: []string{"avg", "p(95)", "p(99.9)"}},
+	}
+	out, err := renderMarkdown(resultData, 50, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "| http_req_duration | 0 | 250.5 | - |"; !strings.Contains(out, want) {
+		t.Errorf("got %q, want a row %q", out, want)
+	}
+}
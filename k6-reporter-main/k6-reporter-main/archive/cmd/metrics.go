@@ -0,0 +1,136 @@
+package main
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Trend stats in the order K6 lists them when not told otherwise, percentiles go last
+var trendStatOrder = []string{"avg", "min", "med", "max", "count"}
+
+// sortedMetricNames lists the names of the metrics in alphabetical order
+func sortedMetricNames(metrics map[string]Metric) []string {
+	names := make([]string, 0, len(metrics))
+	for name := range metrics {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// trendStatColumns is the list of stats to show for trends, as requested by summaryTrendStats if known,
+// otherwise every stat found in the trend metrics
+func trendStatColumns(resultData *ResultData) []string {
+	if len(resultData.Options.SummaryTrendStats) > 0 {
+		return resultData.Options.SummaryTrendStats
+	}
+
+	found := map[string]bool{}
+	for _, metric := range resultData.Metrics {
+		if metric.Type == "trend" {
+			for stat := range metric.Values {
+				found[stat] = true
+			}
+		}
+	}
+	return orderStats(found, trendStatOrder)
+}
+
+// orderStats puts a set of stats in the given order, followed by any percentiles and then anything else
+func orderStats(found map[string]bool, order []string) []string {
+	stats := []string{}
+	for _, stat := range order {
+		if found[stat] {
+			stats = append(stats, stat)
+		}
+	}
+
+	percentiles, others := []string{}, []string{}
+	for stat := range found {
+		switch {
+		case containsString(order, stat):
+		case strings.HasPrefix(stat, "p("):
+			percentiles = append(percentiles, stat)
+		default:
+			others = append(others, stat)
+		}
+	}
+	sort.Slice(percentiles, func(i, j int) bool {
+		return percentileValue(percentiles[i]) < percentileValue(percentiles[j])
+	})
+	sort.Strings(others)
+
+	return append(append(stats, percentiles...), others...)
+}
+
+// containsString checks if a list has a string in it
+func containsString(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
+
+// percentileValue gets the percentile from a stat name, e.g. 99.9 from "p(99.9)"
+func percentileValue(stat string) float64 {
+	value, _ := strconv.ParseFloat(strings.TrimSuffix(strings.TrimPrefix(stat, "p("), ")"), 64)
+	return value
+}
+
+// statFailed reports whether a failed threshold of the metric was evaluated against the given stat
+func statFailed(metric Metric, stat string) bool {
+	for _, thres := range metric.Thresholds {
+		if thres.OK {
+			continue
+		}
+		if expr, err := parseThresholdExpression(thres.Source); err == nil && expr.SinkKey() == normaliseStat(stat) {
+			return true
+		}
+	}
+	return false
+}
+
+// normaliseStat formats percentiles the same way K6 does, so "p(99.90)" and "p(99.9)" are the same stat
+func normaliseStat(stat string) string {
+	if strings.HasPrefix(stat, "p(") {
+		return percentileStat(percentileValue(stat))
+	}
+	return stat
+}
+
+// Stats shown for each type of metric, other than trends which are shown with the trend stat columns
+var metricTypeStats = map[string][]string{
+	"counter": {"count", "rate"},
+	"gauge":   {"value", "min", "max"},
+	"rate":    {"rate", "passes", "fails"},
+}
+
+// metricStats lists the stats to show for a counter, gauge or rate metric, if they're there
+func metricStats(metric Metric) []string {
+	stats := []string{}
+	for _, stat := range metricTypeStats[metric.Type] {
+		if _, ok := metric.Values[stat]; ok {
+			stats = append(stats, stat)
+		}
+	}
+	return stats
+}
+
+// metricFailed reports whether any threshold of the metric failed
+func metricFailed(metric Metric) bool {
+	for _, thres := range metric.Thresholds {
+		if !thres.OK {
+			return true
+		}
+	}
+	return false
+}
+
+// isBuiltinMetric checks if a metric, or the metric of a submetric, is one K6 has built in
+func isBuiltinMetric(name string) bool {
+	_, ok := builtinMetrics[baseMetricName(name)]
+	return ok
+}
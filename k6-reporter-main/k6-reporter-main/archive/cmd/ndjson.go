@@ -0,0 +1,144 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+)
+
+// Decoding of the newline delimited JSON written by `k6 run --out json=results.json`
+// Every line is either a Metric definition, written the first time a metric is seen, or a Point sample
+//  {"type":"Metric","data":{"name":"http_reqs","type":"counter","contains":"default","thresholds":["count>10"],"submetrics":null},"metric":"http_reqs"}
+//  {"type":"Point","data":{"time":"2021-01-08T12:00:00.000Z","value":1,"tags":{"method":"GET","status":"200"}},"metric":"http_reqs"}
+
+// ndjsonLine is a single line of the stream, data is decoded once the type is known
+type ndjsonLine struct {
+	Type   string          `json:"type"`
+	Metric string          `json:"metric"`
+	Data   json.RawMessage `json:"data"`
+}
+
+type ndjsonMetric struct {
+	Name       string            `json:"name"`
+	Type       string            `json:"type"`
+	Contains   string            `json:"contains"`
+	Thresholds []json.RawMessage `json:"thresholds"`
+	Submetrics []struct {
+		Name string            `json:"name"`
+		Tags map[string]string `json:"tags"`
+	} `json:"submetrics"`
+}
+
+type ndjsonPoint struct {
+	Time  time.Time         `json:"time"`
+	Value float64           `json:"value"`
+	Tags  map[string]string `json:"tags"`
+}
+
+// readNDJSON feeds every line of a K6 JSON output stream into the aggregator
+func readNDJSON(r io.Reader, agg *aggregator) error {
+	reader := bufio.NewReader(r)
+	lineNum := 0
+
+	for {
+		line, readErr := reader.ReadBytes('\n')
+		if readErr != nil && readErr != io.EOF {
+			return readErr
+		}
+		lineNum++
+
+		if len(bytes.TrimSpace(line)) > 0 {
+			if err := decodeNDJSONLine(fmt.Sprintf("line %d: $", lineNum), line, agg); err != nil {
+				return err
+			}
+		}
+
+		if readErr == io.EOF {
+			return nil
+		}
+	}
+}
+
+// decodeNDJSONLine decodes a single Metric or Point line into the aggregator
+func decodeNDJSONLine(path string, line []byte, agg *aggregator) error {
+	var entry ndjsonLine
+	if err := json.Unmarshal(line, &entry); err != nil {
+		return &DecodeError{Path: path, Err: describeJSONError(line, err)}
+	}
+
+	switch entry.Type {
+	case "Metric":
+		var metric ndjsonMetric
+		if err := decodeValue(path+".data", entry.Data, &metric); err != nil {
+			return err
+		}
+
+		def := metricDefinition{Name: metric.Name, Type: metric.Type, Contains: metric.Contains}
+		if def.Name == "" {
+			def.Name = entry.Metric
+		}
+		for i, raw := range metric.Thresholds {
+			config, err := decodeThresholdConfig(fmt.Sprintf("%s.data.thresholds[%d]", path, i), raw)
+			if err != nil {
+				return err
+			}
+			def.Thresholds = append(def.Thresholds, config)
+		}
+		for _, sub := range metric.Submetrics {
+			def.Submetrics = append(def.Submetrics, submetricDefinition{Name: sub.Name, Tags: sub.Tags})
+		}
+
+		if err := agg.addDefinition(def); err != nil {
+			return &DecodeError{Path: path + ".data", Err: err}
+		}
+
+	case "Point":
+		var point ndjsonPoint
+		if err := decodeValue(path+".data", entry.Data, &point); err != nil {
+			return err
+		}
+		if entry.Metric == "" {
+			return &DecodeError{Path: path + ".metric", Err: fmt.Errorf("missing metric name")}
+		}
+
+		err := agg.addSample(sample{Metric: entry.Metric, Time: point.Time, Value: point.Value, Tags: point.Tags})
+		if err != nil {
+			return &DecodeError{Path: path, Err: err}
+		}
+
+	default:
+		return &DecodeError{Path: path + ".type", Err: fmt.Errorf("unknown line type %q, expected Metric or Point", entry.Type)}
+	}
+
+	return nil
+}
+
+// decodeThresholdConfig handles both forms K6 writes thresholds in
+// A plain string "p(95)<500", or an object {"threshold":"p(95)<500","abortOnFail":true}
+func decodeThresholdConfig(path string, raw json.RawMessage) (thresholdConfig, error) {
+	var source string
+	if err := json.Unmarshal(raw, &source); err == nil {
+		return thresholdConfig{Source: source}, nil
+	}
+
+	var config struct {
+		Threshold   string `json:"threshold"`
+		AbortOnFail bool   `json:"abortOnFail"`
+	}
+	if err := decodeValue(path, raw, &config); err != nil {
+		return thresholdConfig{}, err
+	}
+	return thresholdConfig{Source: config.Threshold, AbortOnFail: config.AbortOnFail}, nil
+}
+
+// isNDJSON checks if the first line of a file looks like K6 JSON output
+func isNDJSON(firstLine []byte) bool {
+	var entry ndjsonLine
+	if err := json.Unmarshal(firstLine, &entry); err != nil {
+		return false
+	}
+	return entry.Type == "Metric" || entry.Type == "Point"
+}
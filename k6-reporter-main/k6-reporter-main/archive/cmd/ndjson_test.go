@@ -0,0 +1,117 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"strings"
+	"testing"
+)
+
+const ndjsonStream = `{"type":"Metric","data":{"name":"http_req_duration","type":"trend","contains":"time","thresholds":["p(95)<300",{"threshold":"avg<15","abortOnFail":true}],"submetrics":[{"name":"http_req_duration{status:200}","tags":{"status":"200"}}]},"metric":"http_req_duration"}
+{"type":"Point","data":{"time":"2021-01-08T12:00:00Z","value":10,"tags":{"status":"200","group":"::kasir"}},"metric":"http_req_duration"}
+{"type":"Point","data":{"time":"2021-01-08T12:00:05Z","value":20,"tags":{"status":"500","group":"::kasir"}},"metric":"http_req_duration"}
+
+{"type":"Point","data":{"time":"2021-01-08T12:00:10Z","value":30,"tags":{"status":"200","group":"::kasir"}},"metric":"http_req_duration"}
+{"type":"Point","data":{"time":"2021-01-08T12:00:01Z","value":1,"tags":{"check":"status is 200","group":"::kasir"}},"metric":"checks"}
+{"type":"Point","data":{"time":"2021-01-08T12:00:06Z","value":0,"tags":{"check":"status is 200","group":"::kasir"}},"metric":"checks"}
+{"type":"Metric","data":{"name":"orders","type":"counter","contains":"default","thresholds":null,"submetrics":null},"metric":"orders"}
+{"type":"Point","data":{"time":"2021-01-08T12:00:02Z","value":3,"tags":{}},"metric":"orders"}`
+
+func TestReadNDJSON(t *testing.T) {
+	resultData, format, err := loadResults(strings.NewReader(ndjsonStream), inputOptions{Format: formatAuto, TrendStats: []string{"avg", "max", "p(95)"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(format, "NDJSON") {
+		t.Errorf("got format %s, want NDJSON", format)
+	}
+	if resultData.State.TestRunDurationMs != 10000 {
+		t.Errorf("got duration %gms, want 10000ms", resultData.State.TestRunDurationMs)
+	}
+
+	duration := resultData.Metrics["http_req_duration"]
+	if duration.Type != "trend" || duration.Contains != "time" || duration.Values["avg"] != 20 || duration.Values["max"] != 30 {
+		t.Errorf("got http_req_duration %+v", duration)
+	}
+	wantThresholds := []Threshold{{Source: "p(95)<300", OK: true}, {Source: "avg<15", OK: false, AbortOnFail: true}}
+	if len(duration.Thresholds) != len(wantThresholds) {
+		t.Fatalf("got thresholds %+v, want %+v", duration.Thresholds, wantThresholds)
+	}
+	for i, want := range wantThresholds {
+		if duration.Thresholds[i] != want {
+			t.Errorf("got threshold %+v, want %+v", duration.Thresholds[i], want)
+		}
+	}
+
+	if sub := resultData.Metrics["http_req_duration{status:200}"]; sub.Values["avg"] != 20 || sub.Values["max"] != 30 {
+		t.Errorf("got submetric %+v, want the two status 200 samples", sub)
+	}
+	if orders := resultData.Metrics["orders"]; orders.Type != "counter" || orders.Values["count"] != 3 {
+		t.Errorf("got orders %+v", orders)
+	}
+	// Undeclared built-in metrics take their type from K6
+	if checks := resultData.Metrics["checks"]; checks.Type != "rate" || checks.Values["rate"] != 0.5 {
+		t.Errorf("got checks %+v", checks)
+	}
+
+	groups := resultData.RootGroup.Groups
+	if len(groups) != 1 || groups[0].Name != "kasir" || len(groups[0].Checks) != 1 {
+		t.Fatalf("got groups %+v", groups)
+	}
+	if check := groups[0].Checks[0]; check.Passes != 1 || check.Fails != 1 || check.Path != "::kasir::status is 200" {
+		t.Errorf("got check %+v", check)
+	}
+}
+
+func TestReadNDJSONErrors(t *testing.T) {
+	metricLine := `{"type":"Metric","data":{"name":"vus","type":"gauge"},"metric":"vus"}` + "\n"
+	tests := []struct {
+		name  string
+		input string
+		path  string
+	}{
+		{"malformed line", metricLine + `{"type":"Point",` + "\n", "line 2: $"},
+		{"unknown line type", metricLine + `{"type":"Sample","data":{},"metric":"vus"}`, "line 2: $.type"},
+		{"point without metric", metricLine + `{"type":"Point","data":{"time":"2021-01-08T12:00:00Z","value":1}}`, "line 2: $.metric"},
+		{"point with a string value", metricLine + `{"type":"Point","data":{"value":"1"},"metric":"vus"}`, "line 2: $.data"},
+		{"unknown metric type", `{"type":"Metric","data":{"name":"vus","type":"histogram"},"metric":"vus"}`, "line 1: $.data"},
+		{"malformed threshold", `{"type":"Metric","data":{"name":"vus","type":"gauge","thresholds":[{"threshold":5}]},"metric":"vus"}`, "line 1: $.data.thresholds[0]"},
+		{"unparseable threshold", `{"type":"Metric","data":{"name":"vus","type":"gauge","thresholds":["value>"]},"metric":"vus"}`, "line 1: $.data"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := readNDJSON(strings.NewReader(test.input), newAggregator(nil))
+			var decodeErr *DecodeError
+			if !errors.As(err, &decodeErr) {
+				t.Fatalf("got %v, want a DecodeError", err)
+			}
+			if !strings.HasPrefix(decodeErr.Path, test.path) {
+				t.Errorf("got path %s, want %s", decodeErr.Path, test.path)
+			}
+		})
+	}
+}
+
+func TestDetectFormat(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{"ndjson metric", ndjsonStream, formatNDJSON},
+		{"ndjson point", `{"type":"Point","data":{},"metric":"vus"}`, formatNDJSON},
+		{"summary", currentSummary, formatSummary},
+		{"single line summary", `{"metrics":{}}`, formatSummary},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := detectFormat(bufio.NewReaderSize(strings.NewReader(test.input), peekSize))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != test.want {
+				t.Errorf("got %s, want %s", got, test.want)
+			}
+		})
+	}
+}
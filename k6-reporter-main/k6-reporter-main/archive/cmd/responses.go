@@ -0,0 +1,232 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Raw sample inputs are also broken down by how requests were answered, from the status & error_code tags of http_reqs
+// Requests that never got a response, e.g. a dial timeout, have status 0 and a K6 error code, their class is "network"
+
+// Status class of requests that didn't get a response
+const networkClass = "network"
+
+// Descriptions of the error codes K6 sets in the error_code tag, see lib/netext/httpext/error_codes.go in K6
+var errorCodeDescriptions = map[int]string{
+	1000: "Generic error",
+	1010: "Non-TCP network error",
+	1020: "Invalid URL",
+	1050: "Request timeout",
+	1100: "Generic DNS error",
+	1101: "No IP found for the hostname",
+	1110: "Blacklisted IP",
+	1111: "Blocked hostname",
+	1200: "Generic TCP error",
+	1201: "Broken pipe on write",
+	1202: "Unknown TCP error",
+	1210: "Generic TCP dial error",
+	1211: "Dial timeout",
+	1212: "Dial connection refused",
+	1213: "Unknown dial error",
+	1220: "Connection reset by peer",
+	1300: "Generic TLS error",
+	1301: "Unexpected TLS response",
+	1310: "Unknown certificate authority",
+	1311: "Certificate doesn't match the hostname",
+	1600: "Generic HTTP/2 error",
+	1610: "HTTP/2 GoAway error",
+	1630: "HTTP/2 stream error",
+	1650: "HTTP/2 connection error",
+	1701: "Response decompression failed",
+}
+
+// Names of the HTTP/2 error codes, added to the 1611+, 1631+ & 1651+ K6 error codes
+var http2ErrorNames = []string{
+	"NO_ERROR", "PROTOCOL_ERROR", "INTERNAL_ERROR", "FLOW_CONTROL_ERROR", "SETTINGS_TIMEOUT", "STREAM_CLOSED", "FRAME_SIZE_ERROR",
+	"REFUSED_STREAM", "CANCEL", "COMPRESSION_ERROR", "CONNECT_ERROR", "ENHANCE_YOUR_CALM", "INADEQUATE_SECURITY", "HTTP_1_1_REQUIRED",
+}
+
+// Responses is how HTTP requests were answered, of the whole test or one endpoint
+type Responses struct {
+	Requests float64     // http_reqs with a status tag
+	Errors   float64     // Requests with an error class
+	Classes  []CodeCount // Status classes, e.g. 2xx, 4xx & network
+	Statuses []CodeCount // Exact status codes
+	Codes    []CodeCount // K6 error codes, with their description
+}
+
+// CodeCount is the number of requests with a status class, status or error code
+type CodeCount struct {
+	Code        string // e.g. "4xx", "404" or "1211"
+	Count       float64
+	Unexpected  float64 // Requests the expected_response tag says weren't expected, e.g. a 404 can be expected
+	Description string  // Only for error codes
+}
+
+// responseRecorder counts the statuses & error codes of every request
+type responseRecorder struct {
+	requests   float64
+	statuses   map[string]float64
+	codes      map[string]float64
+	unexpected map[string]float64 // Keyed by status, then error code prefixed with "#"
+}
+
+func newResponseRecorder() *responseRecorder {
+	return &responseRecorder{statuses: map[string]float64{}, codes: map[string]float64{}, unexpected: map[string]float64{}}
+}
+
+// add records a sample, if it's a request with a status
+func (r *responseRecorder) add(s sample) {
+	status, ok := s.Tags["status"]
+	if s.Metric != "http_reqs" || !ok {
+		return
+	}
+	unexpected := s.Tags["expected_response"] == "false"
+	r.requests += s.Value
+	r.statuses[status] += s.Value
+	if unexpected {
+		r.unexpected[status] += s.Value
+	}
+	if code := s.Tags["error_code"]; code != "" {
+		r.codes[code] += s.Value
+		if unexpected {
+			r.unexpected["#"+code] += s.Value
+		}
+	}
+}
+
+// result lists the counts in code order, nil when there were no requests
+func (r *responseRecorder) result() *Responses {
+	if r.requests == 0 {
+		return nil
+	}
+	responses := &Responses{
+		Requests: r.requests,
+		Classes:  codeCounts(statusClasses(r.statuses), statusClasses(r.unexpected)),
+		Statuses: codeCounts(r.statuses, r.unexpected),
+		Codes:    codeCounts(r.codes, nil),
+	}
+	for _, class := range responses.Classes {
+		if isErrorClass(class.Code) {
+			responses.Errors += class.Count
+		}
+	}
+	for i := range responses.Codes {
+		responses.Codes[i].Unexpected = r.unexpected["#"+responses.Codes[i].Code]
+		responses.Codes[i].Description = describeErrorCode(responses.Codes[i].Code)
+	}
+	return responses
+}
+
+// statusClass is the class of a status, e.g. "4xx" for "404", or network for requests without a response
+func statusClass(status string) string {
+	if len(status) != 3 || status[0] < '1' || status[0] > '5' {
+		return networkClass
+	}
+	return status[:1] + "xx"
+}
+
+// statusClasses totals counts of statuses by their class, skipping error codes
+func statusClasses(statuses map[string]float64) map[string]float64 {
+	classes := map[string]float64{}
+	for status, count := range statuses {
+		if !strings.HasPrefix(status, "#") {
+			classes[statusClass(status)] += count
+		}
+	}
+	return classes
+}
+
+// isErrorClass checks if a status class is a failure, client & server errors or no response at all
+func isErrorClass(class string) bool {
+	return class == "4xx" || class == "5xx" || class == networkClass
+}
+
+// codeCounts lists counts keyed by code in order, with numbers before anything else e.g. network
+func codeCounts(counts, unexpected map[string]float64) []CodeCount {
+	list := make([]CodeCount, 0, len(counts))
+	for code, count := range counts {
+		list = append(list, CodeCount{Code: code, Count: count, Unexpected: unexpected[code]})
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if digitI, digitJ := isDigit(list[i].Code), isDigit(list[j].Code); digitI != digitJ {
+			return digitI
+		}
+		return list[i].Code < list[j].Code
+	})
+	return list
+}
+
+func isDigit(code string) bool {
+	return code != "" && code[0] >= '0' && code[0] <= '9'
+}
+
+// describeErrorCode describes a K6 error code, e.g. "Dial timeout" for 1211
+func describeErrorCode(code string) string {
+	number, err := strconv.Atoi(code)
+	if err != nil {
+		return ""
+	}
+	if description, ok := errorCodeDescriptions[number]; ok {
+		return description
+	}
+
+	switch {
+	case number >= 1400 && number < 1500:
+		return fmt.Sprintf("HTTP %d client error response", number-1000)
+	case number >= 1500 && number < 1600:
+		return fmt.Sprintf("HTTP %d server error response", number-1000)
+	}
+	for _, base := range []int{1610, 1630, 1650} {
+		if offset := number - base - 1; offset >= 0 && offset < len(http2ErrorNames) {
+			return errorCodeDescriptions[base] + " " + http2ErrorNames[offset]
+		}
+	}
+	switch {
+	case number >= 1100 && number < 1200:
+		return errorCodeDescriptions[1100]
+	case number >= 1200 && number < 1300:
+		return errorCodeDescriptions[1200]
+	case number >= 1300 && number < 1400:
+		return errorCodeDescriptions[1300]
+	case number >= 1600 && number < 1700:
+		return errorCodeDescriptions[1600]
+	}
+	return errorCodeDescriptions[1000]
+}
+
+// errorTimelineCharts draws when each error class happened over the timeline, nothing when there were no errors
+func errorTimelineCharts(locale *Locale, timeline *Timeline) []Chart {
+	if timeline == nil || len(timeline.Buckets) == 0 {
+		return nil
+	}
+	classes := map[string]float64{}
+	for _, bucket := range timeline.Buckets {
+		for class, count := range bucket.Errors {
+			classes[class] += count
+		}
+	}
+	if len(classes) == 0 {
+		return nil
+	}
+
+	start := timeline.Buckets[0].Time
+	elapsed := func(x float64) string {
+		return fmt.Sprint(time.Duration(x * float64(time.Second)).Round(time.Second))
+	}
+	count := func(v float64) string { return locale.FormatNumber(v, 0) }
+	lines := []chartSeries{}
+	for _, class := range codeCounts(classes, nil) {
+		line := chartSeries{Name: class.Code}
+		for _, bucket := range timeline.Buckets {
+			x, y := bucket.Time.Sub(start).Seconds(), bucket.Errors[class.Code]
+			line.Points = append(line.Points, chartPoint{X: x, Y: y, Label: elapsed(x) + ": " + count(y)})
+		}
+		lines = append(lines, line)
+	}
+	title := locale.T("errorsOverTime")
+	return []Chart{{Title: title, SVG: lineChart(title, lines, count, elapsed)}}
+}
@@ -0,0 +1,60 @@
+package main
+
+import "testing"
+
+func TestDescribeErrorCode(t *testing.T) {
+	tests := []struct {
+		code string
+		want string
+	}{
+		{"1211", "Dial timeout"},
+		{"1101", "No IP found for the hostname"},
+		{"1199", "Generic DNS error"},
+		{"1250", "Generic TCP error"},
+		{"1399", "Generic TLS error"},
+		{"1404", "HTTP 404 client error response"},
+		{"1429", "HTTP 429 client error response"},
+		{"1503", "HTTP 503 server error response"},
+		{"1610", "HTTP/2 GoAway error"},
+		{"1611", "HTTP/2 GoAway error NO_ERROR"},
+		{"1631", "HTTP/2 stream error NO_ERROR"},
+		{"1632", "HTTP/2 stream error PROTOCOL_ERROR"},
+		{"1644", "HTTP/2 stream error HTTP_1_1_REQUIRED"},
+		{"1645", "Generic HTTP/2 error"},
+		{"1658", "HTTP/2 connection error REFUSED_STREAM"},
+		{"1999", "Generic error"},
+		{"network", ""},
+		{"", ""},
+	}
+	for _, test := range tests {
+		t.Run(test.code, func(t *testing.T) {
+			if got := describeErrorCode(test.code); got != test.want {
+				t.Errorf("got %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestStatusClass(t *testing.T) {
+	tests := []struct {
+		status string
+		want   string
+	}{
+		{"200", "2xx"},
+		{"101", "1xx"},
+		{"302", "3xx"},
+		{"404", "4xx"},
+		{"503", "5xx"},
+		{"0", networkClass},
+		{"", networkClass},
+		{"600", networkClass},
+		{"2000", networkClass},
+	}
+	for _, test := range tests {
+		t.Run(test.status, func(t *testing.T) {
+			if got := statusClass(test.status); got != test.want {
+				t.Errorf("got %s, want %s", got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,329 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Raw sample inputs are also broken down by scenario, using the scenario tag K6 puts on every sample made by a VU
+// What each scenario was configured to do isn't in the results, it's read from the output of k6 inspect given with -options
+//   k6 inspect --execution-requirements script.js > options.json
+
+// Parameters of scenarios in the order they're shown, anything else goes after these in alphabetical order
+var scenarioParamOrder = []string{
+	"startTime", "vus", "startVUs", "iterations", "rate", "startRate", "timeUnit", "duration", "stages",
+	"preAllocatedVUs", "maxVUs", "maxDuration", "gracefulRampDown", "gracefulStop", "exec", "env", "tags",
+}
+
+// Scenario is the samples of one scenario
+type Scenario struct {
+	Name          string
+	Executor      string          // Only known from the -options file, e.g. ramping-vus
+	Params        []ScenarioParam // Configured parameters from the -options file, e.g. stages
+	TargetRate    float64         // Iterations per second a constant-arrival-rate scenario aimed for
+	StartTime     time.Time       // First & last samples of the scenario
+	EndTime       time.Time
+	DurationMs    float64
+	Iterations    float64 // iterations
+	IterationRate float64 // Iterations per second, while the scenario was running
+	Dropped       float64 // dropped_iterations, iterations an arrival rate scenario had no VU free for
+	Requests      float64 // http_reqs
+	RPS           float64
+	Failed        float64 // Failed http_req_failed samples, out of FailedSamples
+	ErrorRate     float64 // Only known when there are http_req_failed samples
+	HasErrors     bool
+	Trends        []Metric // Trend metrics of just this scenario, sorted by name
+}
+
+// ScenarioParam is a configured parameter of a scenario, formatted for display e.g. "10s → 50, 20s → 0"
+type ScenarioParam struct {
+	Name  string
+	Value string
+}
+
+// scenarioConfig is a scenario as configured in the script options
+type scenarioConfig struct {
+	Executor   string
+	Params     []ScenarioParam
+	TargetRate float64
+}
+
+// scenarioRecorder collects the samples of each scenario, keyed by name
+type scenarioRecorder struct {
+	scenarios map[string]*scenarioSink
+	configs   map[string]scenarioConfig
+}
+
+type scenarioSink struct {
+	first         time.Time
+	last          time.Time
+	iterations    float64
+	dropped       float64
+	requests      float64
+	failed        float64
+	failedSamples float64
+	trends        map[string]*metricSink
+}
+
+func newScenarioRecorder(configs map[string]scenarioConfig) *scenarioRecorder {
+	return &scenarioRecorder{scenarios: map[string]*scenarioSink{}, configs: configs}
+}
+
+// add records a sample of a metric of the given kind, if it's from a scenario
+func (r *scenarioRecorder) add(s sample, kind metricKind) {
+	name := s.Tags["scenario"]
+	if name == "" {
+		return
+	}
+	scenario, ok := r.scenarios[name]
+	if !ok {
+		scenario = &scenarioSink{first: s.Time, last: s.Time, trends: map[string]*metricSink{}}
+		r.scenarios[name] = scenario
+	}
+	if s.Time.Before(scenario.first) {
+		scenario.first = s.Time
+	}
+	if s.Time.After(scenario.last) {
+		scenario.last = s.Time
+	}
+
+	switch s.Metric {
+	case "iterations":
+		scenario.iterations += s.Value
+	case "dropped_iterations":
+		scenario.dropped += s.Value
+	case "http_reqs":
+		scenario.requests += s.Value
+	case "http_req_failed":
+		scenario.failedSamples++
+		if s.Value != 0 {
+			scenario.failed++
+		}
+	}
+	if kind.Type == "trend" {
+		trend, ok := scenario.trends[s.Metric]
+		if !ok {
+			trend = &metricSink{name: s.Metric, kind: kind}
+			scenario.trends[s.Metric] = trend
+		}
+		trend.add(s.Value)
+	}
+}
+
+// result computes the stats of every scenario, sorted by when they started
+// Configured scenarios with no samples are included, nothing is returned for a single unconfigured scenario
+func (r *scenarioRecorder) result(trendStats []string) []Scenario {
+	if len(r.scenarios) == 0 || (len(r.scenarios) == 1 && len(r.configs) == 0) {
+		return nil
+	}
+	scenarios := []Scenario{}
+	for name, sink := range r.scenarios {
+		duration := sink.last.Sub(sink.first)
+		scenario := Scenario{
+			Name:          name,
+			StartTime:     sink.first,
+			EndTime:       sink.last,
+			DurationMs:    float64(duration) / float64(time.Millisecond),
+			Iterations:    sink.iterations,
+			IterationRate: perSecond(sink.iterations, duration),
+			Dropped:       sink.dropped,
+			Requests:      sink.requests,
+			RPS:           perSecond(sink.requests, duration),
+			Failed:        sink.failed,
+			HasErrors:     sink.failedSamples > 0,
+		}
+		if scenario.HasErrors {
+			scenario.ErrorRate = sink.failed / sink.failedSamples
+		}
+		names := make([]string, 0, len(sink.trends))
+		for metricName := range sink.trends {
+			names = append(names, metricName)
+		}
+		sort.Strings(names)
+		for _, metricName := range names {
+			trend := sink.trends[metricName]
+			scenario.Trends = append(scenario.Trends, Metric{
+				Name:     metricName,
+				Type:     trend.kind.Type,
+				Contains: trend.kind.Contains,
+				Values:   trend.stats(trendStats, duration),
+			})
+		}
+		scenarios = append(scenarios, scenario)
+	}
+	for name := range r.configs {
+		if _, ok := r.scenarios[name]; !ok {
+			scenarios = append(scenarios, Scenario{Name: name})
+		}
+	}
+	for i := range scenarios {
+		config := r.configs[scenarios[i].Name]
+		scenarios[i].Executor, scenarios[i].Params, scenarios[i].TargetRate = config.Executor, config.Params, config.TargetRate
+	}
+
+	sort.Slice(scenarios, func(i, j int) bool {
+		if !scenarios[i].StartTime.Equal(scenarios[j].StartTime) {
+			// Scenarios that never ran have a zero start time, they go last
+			return !scenarios[i].StartTime.IsZero() && (scenarios[j].StartTime.IsZero() || scenarios[i].StartTime.Before(scenarios[j].StartTime))
+		}
+		return scenarios[i].Name < scenarios[j].Name
+	})
+	return scenarios
+}
+
+// scenarioOptions is the part of the k6 inspect output describing scenarios, or the shortcuts K6 makes one from
+type scenarioOptions struct {
+	Scenarios  map[string]map[string]interface{} `json:"scenarios"`
+	VUs        interface{}                       `json:"vus"`
+	Duration   interface{}                       `json:"duration"`
+	Iterations interface{}                       `json:"iterations"`
+	Stages     interface{}                       `json:"stages"`
+}
+
+// loadScenarioOptions reads the scenarios from a K6 options file, e.g. the output of k6 inspect
+// Unknown fields are allowed, as it's every option of the test not just the scenarios
+func loadScenarioOptions(filename string) (map[string]scenarioConfig, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	options := scenarioOptions{}
+	if err := json.Unmarshal(data, &options); err != nil {
+		return nil, err
+	}
+
+	// Same as K6 does, without scenarios the shortcut options are turned into a scenario named default
+	if len(options.Scenarios) == 0 {
+		shortcut := map[string]interface{}{"vus": options.VUs}
+		switch {
+		case isSet(options.Stages):
+			shortcut["executor"], shortcut["stages"] = "ramping-vus", options.Stages
+			shortcut["startVUs"] = shortcut["vus"]
+			delete(shortcut, "vus")
+		case isSet(options.Iterations):
+			shortcut["executor"], shortcut["iterations"], shortcut["maxDuration"] = "shared-iterations", options.Iterations, options.Duration
+		case isSet(options.Duration):
+			shortcut["executor"], shortcut["duration"] = "constant-vus", options.Duration
+		default:
+			return nil, fmt.Errorf("no scenarios found, expected the output of k6 inspect")
+		}
+		options.Scenarios = map[string]map[string]interface{}{"default": shortcut}
+	}
+
+	configs := map[string]scenarioConfig{}
+	for name, fields := range options.Scenarios {
+		executor, _ := fields["executor"].(string)
+		if executor == "" {
+			return nil, &DecodeError{Path: fmt.Sprintf("$.scenarios.%s.executor", name), Err: fmt.Errorf("missing executor")}
+		}
+		config := scenarioConfig{Executor: executor, Params: scenarioParams(fields)}
+		if executor == "constant-arrival-rate" {
+			rate, _ := fields["rate"].(float64)
+			timeUnit := time.Second
+			if isSet(fields["timeUnit"]) {
+				if timeUnit, err = optionDuration(fields["timeUnit"]); err != nil || timeUnit <= 0 {
+					return nil, &DecodeError{Path: fmt.Sprintf("$.scenarios.%s.timeUnit", name), Err: fmt.Errorf("invalid time unit %v", fields["timeUnit"])}
+				}
+			}
+			config.TargetRate = rate / timeUnit.Seconds()
+		}
+		configs[name] = config
+	}
+	return configs, nil
+}
+
+// scenarioParams formats the configured parameters of a scenario, leaving out the executor & anything not set
+func scenarioParams(fields map[string]interface{}) []ScenarioParam {
+	names := []string{}
+	for name, value := range fields {
+		if name != "executor" && isSet(value) {
+			names = append(names, name)
+		}
+	}
+	position := func(name string) int {
+		for i, ordered := range scenarioParamOrder {
+			if ordered == name {
+				return i
+			}
+		}
+		return len(scenarioParamOrder)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		if pi, pj := position(names[i]), position(names[j]); pi != pj {
+			return pi < pj
+		}
+		return names[i] < names[j]
+	})
+
+	params := make([]ScenarioParam, 0, len(names))
+	for _, name := range names {
+		params = append(params, ScenarioParam{Name: name, Value: formatOption(name, fields[name])})
+	}
+	return params
+}
+
+// formatOption formats an option value, stages are shown as duration → target
+func formatOption(name string, value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(v)
+	case []interface{}:
+		items := []string{}
+		for _, item := range v {
+			if stage, ok := item.(map[string]interface{}); ok && name == "stages" {
+				items = append(items, formatOption("", stage["duration"])+" → "+formatOption("", stage["target"]))
+			} else {
+				items = append(items, formatOption("", item))
+			}
+		}
+		return strings.Join(items, ", ")
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		items := []string{}
+		for _, key := range keys {
+			items = append(items, key+"="+formatOption("", v[key]))
+		}
+		return strings.Join(items, ", ")
+	}
+	data, _ := json.Marshal(value)
+	return string(data)
+}
+
+// isSet checks if an option has a value, K6 writes options that aren't set as null
+func isSet(value interface{}) bool {
+	switch v := value.(type) {
+	case nil:
+		return false
+	case string:
+		return v != ""
+	case []interface{}:
+		return len(v) > 0
+	case map[string]interface{}:
+		return len(v) > 0
+	}
+	return true
+}
+
+// optionDuration reads a duration option, K6 writes them as strings e.g. "1m30s", but numbers in ms are allowed too
+func optionDuration(value interface{}) (time.Duration, error) {
+	switch v := value.(type) {
+	case string:
+		return time.ParseDuration(v)
+	case float64:
+		return time.Duration(v * float64(time.Millisecond)), nil
+	}
+	return 0, fmt.Errorf("invalid duration %v", value)
+}
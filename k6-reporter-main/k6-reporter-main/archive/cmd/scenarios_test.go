@@ -0,0 +1,85 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadScenarioOptions(t *testing.T) {
+	tests := []struct {
+		name     string
+		options  string
+		scenario string
+		executor string
+		params   string
+		rate     float64
+	}{
+		{"arrival rate per minute", `{"scenarios": {"order": {"executor": "constant-arrival-rate", "maxVUs": 20, "duration": "5m", "preAllocatedVUs": 10, "timeUnit": "1m", "rate": 30, "gracefulStop": ""}}}`,
+			"order", "constant-arrival-rate", "rate=30 timeUnit=1m duration=5m preAllocatedVUs=10 maxVUs=20", 0.5},
+		{"arrival rate per second", `{"scenarios": {"order": {"executor": "constant-arrival-rate", "rate": 30, "duration": "1m"}}}`,
+			"order", "constant-arrival-rate", "rate=30 duration=1m", 30},
+		{"stages", `{"scenarios": {"browse": {"executor": "ramping-vus", "stages": [{"duration": "1m", "target": 10}, {"duration": "30s", "target": 0}], "tags": {"team": "tms"}}}}`,
+			"browse", "ramping-vus", "stages=1m → 10, 30s → 0 tags=team=tms", 0},
+		{"vus & duration shortcut", `{"vus": 10, "duration": "2m"}`, "default", "constant-vus", "vus=10 duration=2m", 0},
+		{"stages shortcut", `{"vus": 2, "stages": [{"duration": "1m", "target": 10}]}`, "default", "ramping-vus", "startVUs=2 stages=1m → 10", 0},
+		{"iterations shortcut", `{"iterations": 100, "vus": 5}`, "default", "shared-iterations", "vus=5 iterations=100", 0},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			configs, err := loadScenarioOptions(writeOptions(t, test.options))
+			if err != nil {
+				t.Fatal(err)
+			}
+			config, ok := configs[test.scenario]
+			if !ok || len(configs) != 1 {
+				t.Fatalf("got %+v, want only scenario %s", configs, test.scenario)
+			}
+			params := ""
+			for i, param := range config.Params {
+				if i > 0 {
+					params += " "
+				}
+				params += param.Name + "=" + param.Value
+			}
+			if config.Executor != test.executor || params != test.params || config.TargetRate != test.rate {
+				t.Errorf("got %s %q rate %v, want %s %q rate %v", config.Executor, params, config.TargetRate, test.executor, test.params, test.rate)
+			}
+		})
+	}
+}
+
+func TestLoadScenarioOptionsErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		options string
+		path    string
+	}{
+		{"not json", `scenarios:`, ""},
+		{"no scenarios", `{"thresholds": {}}`, ""},
+		{"missing executor", `{"scenarios": {"browse": {"vus": 10}}}`, "$.scenarios.browse.executor"},
+		{"zero time unit", `{"scenarios": {"order": {"executor": "constant-arrival-rate", "rate": 30, "timeUnit": "0s"}}}`, "$.scenarios.order.timeUnit"},
+		{"bad time unit", `{"scenarios": {"order": {"executor": "constant-arrival-rate", "rate": 30, "timeUnit": "minute"}}}`, "$.scenarios.order.timeUnit"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := loadScenarioOptions(writeOptions(t, test.options))
+			if err == nil {
+				t.Fatal("got no error")
+			}
+			var decodeErr *DecodeError
+			if test.path != "" && (!errors.As(err, &decodeErr) || decodeErr.Path != test.path) {
+				t.Errorf("got %v, want an error at %s", err, test.path)
+			}
+		})
+	}
+}
+
+func writeOptions(t *testing.T, options string) string {
+	filename := filepath.Join(t.TempDir(), "options.json")
+	if err := os.WriteFile(filename, []byte(options), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return filename
+}
@@ -0,0 +1,410 @@
+package main
+
+import (
+	"crypto/subtle"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"html/template"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The serve command is a report server on top of the history store, it needs nothing but the store so works offline
+//  GET  /                  - stored runs, to open a report, compare two runs or see the trend of a script
+//  GET  /runs/<id>         - HTML report of a run
+//  GET  /compare?baseline=<id>&candidate=<id> - comparison of two runs
+//  GET  /trend?script=<script>&env=<env>      - history report, charts across runs
+//  GET  /api/runs          - stored runs as JSON
+//  POST /api/runs?script=<script>&env=<env>&commit=<commit>&label=<label> - add a run, the body is results in any input format
+// Results can be posted straight from the handleSummary function of a K6 script
+
+//go:embed "templates/runs.tmpl"
+var runsTemplateString string
+
+// Default title pattern of the run list
+const defaultRunsTitlePattern = "K6 Runs"
+
+// Default of the largest results the server accepts in MiB, NDJSON output of long tests gets big
+const defaultMaxUploadMiB = 64
+
+// Timeouts of the server, reads are slow when large results are uploaded
+const (
+	serverReadHeaderTimeout = 10 * time.Second
+	serverReadTimeout       = 5 * time.Minute
+	serverIdleTimeout       = 2 * time.Minute
+)
+
+// Environment variable with the token, so it doesn't have to be on the command line
+const tokenEnvVar = "K6_REPORTER_TOKEN"
+
+// RunsView is the data the run list template is rendered with
+type RunsView struct {
+	Brand       Branding
+	Generated   time.Time
+	Script      string
+	Environment string
+	Runs        []Run // Newest first
+}
+
+// reportServer serves reports of the runs in a history store
+type reportServer struct {
+	store     *historyStore
+	token     string
+	maxUpload int64 // Largest results accepted, in bytes
+	tolerance Tolerance
+	inOpts    inputOptions
+	brandOpts brandingOptions
+	locale    *Locale
+	zone      *time.Location
+	report    *template.Template
+	compare   *template.Template
+	history   *template.Template
+	runs      *template.Template
+}
+
+// runServe is the serve command
+func runServe(args []string) {
+	fs := flag.NewFlagSet("serve", flag.ExitOnError)
+	var historyDir = fs.String("history", "./history", "Directory of the history store")
+	var listen = fs.String("listen", "localhost:8080", "Address to listen on, e.g. :8080 for every interface")
+	var token = fs.String("token", os.Getenv(tokenEnvVar), "Token needed to use the server, as a bearer token or basic auth password, defaults to $"+tokenEnvVar)
+	var maxUpload = fs.Int64("maxupload", defaultMaxUploadMiB, "Largest results the server accepts, in MiB")
+	var tolerance = Tolerance{}
+	fs.Float64Var(&tolerance.Warn, "warn", 5, "Tolerance in percent (points for rates) of comparisons, changes within it are unchanged")
+	fs.Float64Var(&tolerance.Fail, "fail", 10, "Tolerance in percent (points for rates) of comparisons, worse changes past it are regressions")
+	var brandOpts = brandingOptions{}
+	addBrandingFlags(fs, &brandOpts, defaultTitlePattern)
+	var inFlags = addInputFlags(fs)
+	var localeFlags = addLocaleFlags(fs)
+	_ = fs.Parse(args)
+	if tolerance.Fail < tolerance.Warn {
+		fmt.Printf("\n🚫 The -fail tolerance can't be less than -warn\n\n")
+		os.Exit(1)
+	}
+	if *maxUpload <= 0 {
+		fmt.Printf("\n🚫 The -maxupload size must be at least 1 MiB\n\n")
+		os.Exit(1)
+	}
+
+	server := &reportServer{token: *token, maxUpload: *maxUpload << 20, tolerance: tolerance, brandOpts: brandOpts}
+	var err error
+	if server.inOpts, err = inFlags.options(); err != nil {
+		fmt.Println("💥 Input options error", err)
+		os.Exit(1)
+	}
+	if server.locale, server.zone, err = localeFlags.resolve(); err != nil {
+		fmt.Println("💥 Locale error", err)
+		os.Exit(1)
+	}
+	if _, err := newBranding(brandOpts, "", time.Now()); err != nil {
+		fmt.Println("💥 Branding error", err)
+		os.Exit(1)
+	}
+	if server.store, err = openHistory(*historyDir); err != nil {
+		fmt.Println("💥 History error", err)
+		os.Exit(1)
+	}
+	if err := server.parseTemplates(); err != nil {
+		fmt.Println("💥 Template error", err)
+		os.Exit(1)
+	}
+
+	if server.token == "" {
+		fmt.Printf("\n⚠️  No -token set, anyone who can reach %s can see and add runs\n", *listen)
+	}
+	fmt.Printf("\n🌐 Serving the history at %s on http://%s/\n", *historyDir, *listen)
+	httpServer := &http.Server{
+		Addr:              *listen,
+		Handler:           server.routes(),
+		ReadHeaderTimeout: serverReadHeaderTimeout,
+		ReadTimeout:       serverReadTimeout,
+		IdleTimeout:       serverIdleTimeout,
+	}
+	if err := httpServer.ListenAndServe(); err != nil {
+		fmt.Println("💥 Server error", err)
+		os.Exit(1)
+	}
+}
+
+// parseTemplates parses every page template once, they're safe to execute from many requests at once
+func (s *reportServer) parseTemplates() error {
+	var err error
+	if s.report, err = newReportTemplate("", s.locale, s.zone); err != nil {
+		return err
+	}
+	if s.compare, err = newCompareTemplate(s.locale, s.zone); err != nil {
+		return err
+	}
+	if s.history, err = newHistoryTemplate(s.locale, s.zone); err != nil {
+		return err
+	}
+	if s.runs, err = newReportTemplate("", s.locale, s.zone); err != nil {
+		return err
+	}
+	s.runs, err = s.runs.Parse(runsTemplateString)
+	return err
+}
+
+// routes sets up the handlers, all behind the token & origin checks
+func (s *reportServer) routes() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", s.handleRuns)
+	mux.HandleFunc("/runs/", s.handleReport)
+	mux.HandleFunc("/compare", s.handleCompare)
+	mux.HandleFunc("/trend", s.handleTrend)
+	mux.HandleFunc("/api/runs", s.handleAPIRuns)
+	return s.authorize(rejectCrossOrigin(mux))
+}
+
+// authorize checks the token, given as a bearer token by scripts or as the basic auth password by browsers
+func (s *reportServer) authorize(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.token == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if _, password, ok := r.BasicAuth(); ok {
+			token = password
+		}
+		if subtle.ConstantTimeCompare([]byte(token), []byte(s.token)) != 1 {
+			w.Header().Set("WWW-Authenticate", `Basic realm="k6-reporter"`)
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// rejectCrossOrigin stops other sites adding runs through a browser, which sends the basic auth password by itself
+// Browsers send an Origin with every cross-origin POST, scripts like handleSummary don't send one
+func rejectCrossOrigin(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead && !sameOrigin(r) {
+			http.Error(w, "cross-origin request not allowed", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// sameOrigin checks the Origin of a request, if it has one, is the server itself
+func sameOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	originURL, err := url.Parse(origin)
+	return err == nil && originURL.Host == r.Host
+}
+
+// handleRuns lists the stored runs, newest first
+func (s *reportServer) handleRuns(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		http.NotFound(w, r)
+		return
+	}
+	filter, err := queryFilter(r, 0)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	runs, err := s.store.list(filter)
+	if err != nil {
+		s.serverError(w, err)
+		return
+	}
+	for i, j := 0, len(runs)-1; i < j; i, j = i+1, j-1 {
+		runs[i], runs[j] = runs[j], runs[i]
+	}
+
+	view := RunsView{Generated: time.Now(), Script: filter.Script, Environment: filter.Environment, Runs: runs}
+	brandOpts := s.brandOpts
+	brandOpts.TitlePattern = defaultRunsTitlePattern
+	if view.Brand, err = newBranding(brandOpts, "", view.Generated); err != nil {
+		s.serverError(w, err)
+		return
+	}
+	s.render(w, s.runs, view)
+}
+
+// handleReport renders the HTML report of a run
+func (s *reportServer) handleReport(w http.ResponseWriter, r *http.Request) {
+	resultData, run, ok := s.loadRun(w, strings.TrimPrefix(r.URL.Path, "/runs/"))
+	if !ok {
+		return
+	}
+	var err error
+	resultData.Generated = time.Now()
+	if resultData.Brand, err = newBranding(s.brandOpts, resultData.Title, resultData.Generated); err != nil {
+		s.serverError(w, err)
+		return
+	}
+	s.render(w, s.report, newReportView(resultData, run.InputFile, run.InputFormat))
+}
+
+// handleCompare renders the comparison of two runs
+func (s *reportServer) handleCompare(w http.ResponseWriter, r *http.Request) {
+	baseline, baseRun, ok := s.loadRun(w, r.URL.Query().Get("baseline"))
+	if !ok {
+		return
+	}
+	candidate, candRun, ok := s.loadRun(w, r.URL.Query().Get("candidate"))
+	if !ok {
+		return
+	}
+
+	var err error
+	comparison := compareResults(baseline, candidate, s.tolerance)
+	comparison.Baseline = RunInfo{File: runName(baseRun), Format: baseRun.InputFormat, DurationMs: baseRun.DurationMs}
+	comparison.Candidate = RunInfo{File: runName(candRun), Format: candRun.InputFormat, DurationMs: candRun.DurationMs}
+	comparison.Title = candidate.Title
+	comparison.Generated = time.Now()
+	brandOpts := s.brandOpts
+	brandOpts.TitlePattern = defaultCompareTitlePattern
+	if comparison.Brand, err = newBranding(brandOpts, comparison.Title, comparison.Generated); err != nil {
+		s.serverError(w, err)
+		return
+	}
+	s.render(w, s.compare, comparison)
+}
+
+// handleTrend renders the history report of the runs matching the query
+func (s *reportServer) handleTrend(w http.ResponseWriter, r *http.Request) {
+	filter, err := queryFilter(r, 20)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	runs, filter, err := s.store.trend(filter)
+	if err != nil {
+		s.serverError(w, err)
+		return
+	}
+	if len(runs) == 0 {
+		http.Error(w, "no runs found", http.StatusNotFound)
+		return
+	}
+	brandOpts := s.brandOpts
+	brandOpts.TitlePattern = defaultHistoryTitlePattern
+	view, err := newHistoryView(runs, filter, brandOpts, s.locale, s.zone)
+	if err != nil {
+		s.serverError(w, err)
+		return
+	}
+	s.render(w, s.history, view)
+}
+
+// handleAPIRuns lists runs as JSON, or adds a run posted to it
+func (s *reportServer) handleAPIRuns(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		filter, err := queryFilter(r, 0)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		runs, err := s.store.list(filter)
+		if err != nil {
+			s.serverError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, runs)
+
+	case http.MethodPost:
+		query := r.URL.Query()
+		run := Run{Script: query.Get("script"), Environment: query.Get("env"), Commit: query.Get("commit"), Label: query.Get("label")}
+		title := query.Get("title")
+		if title == "" {
+			title = run.Script
+		}
+		if title == "" {
+			title = "Upload"
+		}
+
+		// NDJSON & CSV are decoded as they stream in, only summaries are read whole
+		resultData, formatName, err := decodeResults(http.MaxBytesReader(w, r.Body, s.maxUpload), title, s.inOpts)
+		if err != nil {
+			http.Error(w, "invalid results: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		if run, err = s.store.add(describeRun(run, resultData, "upload", formatName), resultData); err != nil {
+			s.serverError(w, err)
+			return
+		}
+		fmt.Printf("\n📥 Run %s of %s uploaded from %s\n", run.ID, run.Script, r.RemoteAddr)
+		w.Header().Set("Location", "/runs/"+run.ID)
+		writeJSON(w, http.StatusCreated, run)
+
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// loadRun loads a stored run, replying with an error if it can't
+func (s *reportServer) loadRun(w http.ResponseWriter, id string) (*ResultData, Run, bool) {
+	resultData, run, err := s.store.load(id)
+	if err == nil {
+		return resultData, run, true
+	}
+	if os.IsNotExist(err) || !runIDPattern.MatchString(id) {
+		http.Error(w, fmt.Sprintf("run %q not found", id), http.StatusNotFound)
+	} else {
+		s.serverError(w, err)
+	}
+	return nil, run, false
+}
+
+// render executes a page template, buffering it so a template error doesn't leave half a page
+func (s *reportServer) render(w http.ResponseWriter, tmpl *template.Template, data interface{}) {
+	page := &strings.Builder{}
+	if err := tmpl.Execute(page, data); err != nil {
+		s.serverError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	_, _ = w.Write([]byte(page.String()))
+}
+
+func (s *reportServer) serverError(w http.ResponseWriter, err error) {
+	fmt.Println("💥 Server error", err)
+	http.Error(w, "internal server error", http.StatusInternalServerError)
+}
+
+func writeJSON(w http.ResponseWriter, status int, data interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(data)
+}
+
+// queryFilter selects runs with the script, env, commit, label & last query parameters
+func queryFilter(r *http.Request, last int) (runFilter, error) {
+	query := r.URL.Query()
+	filter := runFilter{Script: query.Get("script"), Environment: query.Get("env"), Commit: query.Get("commit"), Label: query.Get("label"), Last: last}
+	if value := query.Get("last"); value != "" {
+		var err error
+		if filter.Last, err = strconv.Atoi(value); err != nil || filter.Last < 0 {
+			return filter, errors.New("last must be a number of runs")
+		}
+	}
+	return filter, nil
+}
+
+// runName describes a run in a comparison, e.g. "kasir.js staging nightly (20250101-030000-94bdbf7e)"
+func runName(run Run) string {
+	name := run.Script
+	for _, part := range []string{run.Environment, run.Label, shortCommit(run.Commit)} {
+		if part != "" {
+			name += " " + part
+		}
+	}
+	return name + " (" + run.ID + ")"
+}
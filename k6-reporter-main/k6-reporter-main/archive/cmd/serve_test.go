@@ -0,0 +1,60 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestServeUploads(t *testing.T) {
+	store, err := openHistory(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := &reportServer{store: store, token: "s3cret", maxUpload: 1 << 10, inOpts: inputOptions{Format: formatAuto}}
+	handler := server.routes()
+	summary := `{"metrics": {"http_reqs": {"type": "counter", "values": {"count": 10, "rate": 1}}}}`
+
+	tests := []struct {
+		name   string
+		body   string
+		header map[string]string
+		basic  bool
+		want   int
+	}{
+		{"bearer token", summary, map[string]string{"Authorization": "Bearer s3cret"}, false, http.StatusCreated},
+		{"basic auth", summary, nil, true, http.StatusCreated},
+		{"basic auth from the server", summary, map[string]string{"Origin": "http://reports.local"}, true, http.StatusCreated},
+		{"basic auth from another site", summary, map[string]string{"Origin": "https://evil.example"}, true, http.StatusForbidden},
+		{"opaque origin", summary, map[string]string{"Origin": "null"}, true, http.StatusForbidden},
+		{"wrong token", summary, map[string]string{"Authorization": "Bearer guess"}, false, http.StatusUnauthorized},
+		{"too large", `{"metrics": {}, "padding": "` + strings.Repeat("x", 2<<10) + `"}`, map[string]string{"Authorization": "Bearer s3cret"}, false, http.StatusBadRequest},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "http://reports.local/api/runs?script=kasir.js", strings.NewReader(test.body))
+			for key, value := range test.header {
+				req.Header.Set(key, value)
+			}
+			if test.basic {
+				req.SetBasicAuth("ci", "s3cret")
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+			if rec.Code != test.want {
+				t.Errorf("got status %d, want %d: %s", rec.Code, test.want, rec.Body.String())
+			}
+		})
+	}
+
+	// Reads from another site are still allowed, a browser won't let it see the reply
+	req := httptest.NewRequest(http.MethodGet, "http://reports.local/api/runs", nil)
+	req.Header.Set("Origin", "https://evil.example")
+	req.SetBasicAuth("ci", "s3cret")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "kasir.js") {
+		t.Errorf("got status %d & %s, want the stored runs", rec.Code, rec.Body.String())
+	}
+}
@@ -0,0 +1,320 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Raw sample inputs can be scored from the http_req_duration of every request, given an SLO file with -slo
+//  {"apdex": {"satisfied": 500},
+//   "apdexRules": [{"endpoint": "grouping_route", "satisfied": 800}, {"group": "kasir", "satisfied": 300}],
+//   "slos": [{"name": "Grouping route", "endpoint": "grouping_route", "target": 99, "under": 800}]}
+// Apdex is (satisfied + tolerating / 2) / requests, requests that failed are always frustrated
+// An SLO is the percentage of requests that must be good, i.e. not failed & no slower than under if it's set
+
+// Apdex ratings, from the lowest score of each
+var apdexRatings = []struct {
+	min    float64
+	rating string
+}{
+	{0.94, "Excellent"}, {0.85, "Good"}, {0.70, "Fair"}, {0.50, "Poor"}, {0, "Unacceptable"},
+}
+
+// Apdex is the Apdex score of a set of requests
+type Apdex struct {
+	Score        float64 // From 0 to 1
+	Rating       string  // Excellent, Good, Fair, Poor or Unacceptable
+	Satisfied    float64 // Requests no slower than SatisfiedMs
+	Tolerating   float64 // Requests no slower than ToleratingMs
+	Frustrated   float64 // Slower requests, and requests that failed
+	SatisfiedMs  float64 // Thresholds the requests were scored with, 0 when they were scored with different thresholds
+	ToleratingMs float64
+}
+
+// SLO is how a set of requests did against a service level objective
+type SLO struct {
+	Name            string
+	Method          string  // Requests the SLO is of, an empty value matches anything
+	Endpoint        string  // Part of the endpoint name, e.g. grouping_route
+	Group           string  // Group path, including any groups under it
+	Target          float64 // Percentage of requests that must be good, e.g. 99
+	UnderMs         float64 // Good requests are no slower than this, 0 when only failed requests are bad
+	Requests        float64
+	Good            float64
+	Achieved        float64 // Percentage of requests that were good
+	BudgetRemaining float64 // Fraction of the error budget, the bad requests allowed, that was left, negative when it was overspent
+	Met             bool
+}
+
+// sloRules is an SLO file
+type sloRules struct {
+	Apdex      *apdexRule  `json:"apdex"`      // Default Apdex thresholds, when no Apdex rule matches
+	ApdexRules []apdexRule `json:"apdexRules"` // Apdex thresholds of endpoints or groups, the first that matches is used
+	SLOs       []sloRule   `json:"slos"`
+}
+
+// requestMatch picks out requests by method, endpoint & group, empty fields match anything
+type requestMatch struct {
+	Method   string `json:"method"`
+	Endpoint string `json:"endpoint"`
+	Group    string `json:"group"` // e.g. "kasir::grouping route", the same as in gate rules
+}
+
+// apdexRule is a pair of Apdex thresholds
+type apdexRule struct {
+	requestMatch
+	Satisfied  float64 `json:"satisfied"`  // In ms, known as T
+	Tolerating float64 `json:"tolerating"` // In ms, 4T when not set
+}
+
+// sloRule is a service level objective
+type sloRule struct {
+	requestMatch
+	Name   string  `json:"name"`
+	Target float64 `json:"target"`
+	Under  float64 `json:"under"`
+}
+
+// loadSLORules reads and checks an SLO file, unknown fields are an error so typos don't go unnoticed
+func loadSLORules(filename string) (*sloRules, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	rules := &sloRules{}
+	decoder := json.NewDecoder(file)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(rules); err != nil {
+		return nil, err
+	}
+	if rules.Apdex == nil && len(rules.ApdexRules) == 0 && len(rules.SLOs) == 0 {
+		return nil, errors.New("no apdex thresholds or slos found")
+	}
+	if rules.Apdex != nil {
+		if err := rules.Apdex.validate(); err != nil {
+			return nil, &DecodeError{Path: "$.apdex", Err: err}
+		}
+	}
+	for i := range rules.ApdexRules {
+		if err := rules.ApdexRules[i].validate(); err != nil {
+			return nil, &DecodeError{Path: fmt.Sprintf("$.apdexRules[%d]", i), Err: err}
+		}
+	}
+	for i := range rules.SLOs {
+		if err := rules.SLOs[i].validate(); err != nil {
+			return nil, &DecodeError{Path: fmt.Sprintf("$.slos[%d]", i), Err: err}
+		}
+	}
+	return rules, nil
+}
+
+func (r *apdexRule) validate() error {
+	if r.Satisfied <= 0 {
+		return errors.New("satisfied must be more than 0ms")
+	}
+	if r.Tolerating == 0 {
+		r.Tolerating = 4 * r.Satisfied
+	}
+	if r.Tolerating < r.Satisfied {
+		return fmt.Errorf("tolerating %gms is less than satisfied %gms", r.Tolerating, r.Satisfied)
+	}
+	return nil
+}
+
+func (r *sloRule) validate() error {
+	if r.Target <= 0 || r.Target >= 100 {
+		return fmt.Errorf("target %g must be a percentage between 0 and 100, e.g. 99.9", r.Target)
+	}
+	if r.Under < 0 {
+		return fmt.Errorf("under %gms can't be negative", r.Under)
+	}
+	if r.Name == "" {
+		r.Name = r.label()
+	}
+	return nil
+}
+
+// label describes an SLO that wasn't given a name, e.g. "99% of GET grouping_route under 800ms"
+func (r *sloRule) label() string {
+	scope := strings.TrimSpace(strings.Join([]string{r.Method, r.Endpoint}, " "))
+	if scope == "" {
+		scope = "requests"
+	}
+	if r.Group != "" {
+		scope += " in " + r.Group
+	}
+	label := fmt.Sprintf("%g%% of %s", r.Target, scope)
+	if r.Under > 0 {
+		label += fmt.Sprintf(" under %gms", r.Under)
+	}
+	return label
+}
+
+// matches checks if a request is picked out, by its method, endpoint name & group tag
+func (m requestMatch) matches(method, endpoint, group string) bool {
+	if m.Method != "" && !strings.EqualFold(m.Method, method) {
+		return false
+	}
+	if m.Endpoint != "" && !strings.Contains(endpoint, m.Endpoint) {
+		return false
+	}
+	if m.Group != "" {
+		path := groupPathSeparator + strings.TrimPrefix(m.Group, groupPathSeparator)
+		if group != path && !strings.HasPrefix(group, path+groupPathSeparator) {
+			return false
+		}
+	}
+	return true
+}
+
+// scoreRecorder scores every request against the SLO file, as they're read
+type scoreRecorder struct {
+	rules     *sloRules
+	endpoints *endpointRecorder // For the names of endpoints, normalised the same way
+	apdex     *apdexCounter
+	byName    map[string]*apdexCounter // Keyed by method & endpoint name, the same as endpoints
+	slos      []SLO
+}
+
+type apdexCounter struct {
+	satisfied    float64
+	tolerating   float64
+	frustrated   float64
+	thresholds   apdexRule
+	mixed        bool // Scored with more than one pair of thresholds
+	hasThreshold bool
+}
+
+func newScoreRecorder(endpoints *endpointRecorder) *scoreRecorder {
+	return &scoreRecorder{endpoints: endpoints, apdex: &apdexCounter{}, byName: map[string]*apdexCounter{}}
+}
+
+// setRules sets the SLO file the requests are scored against, nil to not score them
+func (r *scoreRecorder) setRules(rules *sloRules) {
+	r.rules = rules
+	r.slos = nil
+	if rules == nil {
+		return
+	}
+	for _, rule := range rules.SLOs {
+		r.slos = append(r.slos, SLO{
+			Name: rule.Name, Method: rule.Method, Endpoint: rule.Endpoint, Group: rule.Group, Target: rule.Target, UnderMs: rule.Under,
+		})
+	}
+}
+
+// add scores a sample, if it's the duration of a request
+func (r *scoreRecorder) add(s sample) {
+	if r.rules == nil || s.Metric != "http_req_duration" {
+		return
+	}
+	method, name, _ := r.endpoints.name(s)
+	group := s.Tags["group"]
+	failed := s.Tags["expected_response"] == "false"
+
+	if thresholds := r.thresholds(method, name, group); thresholds != nil {
+		r.apdex.add(s.Value, failed, *thresholds)
+		if name != "" {
+			key := method + " " + name
+			counter, ok := r.byName[key]
+			if !ok {
+				counter = &apdexCounter{}
+				r.byName[key] = counter
+			}
+			counter.add(s.Value, failed, *thresholds)
+		}
+	}
+
+	for i, rule := range r.rules.SLOs {
+		if rule.matches(method, name, group) {
+			r.slos[i].Requests++
+			if !failed && (rule.Under == 0 || s.Value <= rule.Under) {
+				r.slos[i].Good++
+			}
+		}
+	}
+}
+
+// thresholds finds the Apdex thresholds of a request, nil when it isn't scored
+func (r *scoreRecorder) thresholds(method, endpoint, group string) *apdexRule {
+	for i := range r.rules.ApdexRules {
+		if r.rules.ApdexRules[i].matches(method, endpoint, group) {
+			return &r.rules.ApdexRules[i]
+		}
+	}
+	return r.rules.Apdex
+}
+
+func (c *apdexCounter) add(duration float64, failed bool, thresholds apdexRule) {
+	switch {
+	case failed || duration > thresholds.Tolerating:
+		c.frustrated++
+	case duration > thresholds.Satisfied:
+		c.tolerating++
+	default:
+		c.satisfied++
+	}
+	if c.hasThreshold && (c.thresholds.Satisfied != thresholds.Satisfied || c.thresholds.Tolerating != thresholds.Tolerating) {
+		c.mixed = true
+	}
+	c.thresholds, c.hasThreshold = thresholds, true
+}
+
+// result is the Apdex score, nil when no requests were scored
+func (c *apdexCounter) result() *Apdex {
+	total := c.satisfied + c.tolerating + c.frustrated
+	if total == 0 {
+		return nil
+	}
+	apdex := &Apdex{
+		Score:      (c.satisfied + c.tolerating/2) / total,
+		Satisfied:  c.satisfied,
+		Tolerating: c.tolerating,
+		Frustrated: c.frustrated,
+	}
+	if !c.mixed {
+		apdex.SatisfiedMs, apdex.ToleratingMs = c.thresholds.Satisfied, c.thresholds.Tolerating
+	}
+	for _, rating := range apdexRatings {
+		if apdex.Score >= rating.min {
+			apdex.Rating = rating.rating
+			break
+		}
+	}
+	return apdex
+}
+
+// apdexOf is the Apdex score of an endpoint, nil when its requests weren't scored
+func (r *scoreRecorder) apdexOf(method, name string) *Apdex {
+	if counter, ok := r.byName[method+" "+name]; ok {
+		return counter.result()
+	}
+	return nil
+}
+
+// result computes the Apdex score of all requests & how every SLO did
+// An SLO with no requests is met, as none of its error budget was spent
+func (r *scoreRecorder) result() (*Apdex, []SLO) {
+	if r.rules == nil {
+		return nil, nil
+	}
+	slos := append([]SLO{}, r.slos...)
+	for i := range slos {
+		slo := &slos[i]
+		slo.Achieved, slo.BudgetRemaining, slo.Met = 100, 1, true
+		if slo.Requests == 0 {
+			continue
+		}
+		bad := slo.Requests - slo.Good
+		allowed := slo.Requests * (100 - slo.Target) / 100
+		slo.Achieved = slo.Good / slo.Requests * 100
+		slo.BudgetRemaining = 1 - bad/allowed
+		slo.Met = slo.Achieved >= slo.Target
+	}
+	return r.apdex.result(), slos
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+func TestApdexResult(t *testing.T) {
+	tests := []struct {
+		name       string
+		satisfied  float64
+		tolerating float64
+		frustrated float64
+		score      float64
+		rating     string
+	}{
+		{"all satisfied", 10, 0, 0, 1, "Excellent"},
+		{"lowest excellent", 94, 0, 6, 0.94, "Excellent"},
+		{"tolerating count half", 80, 10, 10, 0.85, "Good"},
+		{"fair", 60, 20, 20, 0.70, "Fair"},
+		{"lowest poor", 0, 100, 0, 0.5, "Poor"},
+		{"all frustrated", 0, 0, 5, 0, "Unacceptable"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			counter := &apdexCounter{satisfied: test.satisfied, tolerating: test.tolerating, frustrated: test.frustrated}
+			apdex := counter.result()
+			if math.Abs(apdex.Score-test.score) > 1e-9 || apdex.Rating != test.rating {
+				t.Errorf("got %v %s, want %v %s", apdex.Score, apdex.Rating, test.score, test.rating)
+			}
+		})
+	}
+
+	if apdex := (&apdexCounter{}).result(); apdex != nil {
+		t.Errorf("got %+v with no requests, want nil", apdex)
+	}
+}
+
+func TestScoreRecorder(t *testing.T) {
+	rules := &sloRules{
+		Apdex: &apdexRule{Satisfied: 500},
+		SLOs: []sloRule{
+			{Name: "fast", Target: 75, Under: 800},
+			{Name: "no failures", Target: 50},
+			{Name: "unused", requestMatch: requestMatch{Endpoint: "grouping_route"}, Target: 99.9},
+		},
+	}
+	if err := rules.Apdex.validate(); err != nil {
+		t.Fatal(err)
+	}
+	recorder := newScoreRecorder(newEndpointRecorder(nil))
+	recorder.setRules(rules)
+	tags := map[string]string{"method": "GET", "url": "https://tms.example.com/order/1", "expected_response": "true"}
+	for _, duration := range []float64{100, 200, 300, 400, 600, 1500, 2500} {
+		recorder.add(sample{Metric: "http_req_duration", Value: duration, Tags: tags})
+	}
+	recorder.add(sample{Metric: "http_req_duration", Value: 100, Tags: map[string]string{"method": "GET", "url": "https://tms.example.com/order/2", "expected_response": "false"}})
+	recorder.add(sample{Metric: "http_reqs", Value: 1, Tags: tags})
+
+	apdex, slos := recorder.result()
+	if apdex.Satisfied != 4 || apdex.Tolerating != 2 || apdex.Frustrated != 2 || apdex.Score != 0.625 || apdex.Rating != "Poor" {
+		t.Errorf("got apdex %+v, want 4 satisfied, 2 tolerating & 2 frustrated scoring 0.625", apdex)
+	}
+	if apdex.SatisfiedMs != 500 || apdex.ToleratingMs != 2000 {
+		t.Errorf("got thresholds %v & %v, want 500 & 2000", apdex.SatisfiedMs, apdex.ToleratingMs)
+	}
+	if endpoint := recorder.apdexOf("GET", "https://tms.example.com/order/{id}"); endpoint == nil || endpoint.Score != apdex.Score {
+		t.Errorf("got endpoint apdex %+v, want the same as overall", endpoint)
+	}
+
+	tests := []struct {
+		requests float64
+		good     float64
+		achieved float64
+		budget   float64
+		met      bool
+	}{
+		{8, 5, 62.5, -0.5, false},
+		{8, 7, 87.5, 0.75, true},
+		{0, 0, 100, 1, true},
+	}
+	for i, test := range tests {
+		t.Run(slos[i].Name, func(t *testing.T) {
+			slo := slos[i]
+			if slo.Requests != test.requests || slo.Good != test.good {
+				t.Errorf("got %v good of %v, want %v of %v", slo.Good, slo.Requests, test.good, test.requests)
+			}
+			if slo.Achieved != test.achieved || slo.BudgetRemaining != test.budget || slo.Met != test.met {
+				t.Errorf("got achieved %v, budget %v & met %v, want %v, %v & %v", slo.Achieved, slo.BudgetRemaining, slo.Met, test.achieved, test.budget, test.met)
+			}
+		})
+	}
+}
+
+func TestScoreRecorderNoRules(t *testing.T) {
+	recorder := newScoreRecorder(newEndpointRecorder(nil))
+	recorder.add(sample{Metric: "http_req_duration", Value: 100, Tags: map[string]string{"method": "GET", "url": "/"}})
+	if apdex, slos := recorder.result(); apdex != nil || slos != nil {
+		t.Errorf("got %+v & %+v, want nothing scored", apdex, slos)
+	}
+}
+
+func TestSLORuleValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		rule    sloRule
+		label   string
+		wantErr bool
+	}{
+		{"target & under", sloRule{requestMatch: requestMatch{Method: "GET", Endpoint: "grouping_route"}, Target: 99, Under: 800}, "99% of GET grouping_route under 800ms", false},
+		{"group", sloRule{requestMatch: requestMatch{Group: "kasir"}, Target: 99.9}, "99.9% of requests in kasir", false},
+		{"named", sloRule{Name: "Checkout", Target: 95}, "Checkout", false},
+		{"target of 100 has no error budget", sloRule{Target: 100}, "", true},
+		{"target of 0", sloRule{Target: 0}, "", true},
+		{"negative under", sloRule{Target: 99, Under: -1}, "", true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := test.rule.validate()
+			if (err != nil) != test.wantErr {
+				t.Fatalf("got error %v, want error %v", err, test.wantErr)
+			}
+			if err == nil && test.rule.Name != test.label {
+				t.Errorf("got name %q, want %q", test.rule.Name, test.label)
+			}
+		})
+	}
+}
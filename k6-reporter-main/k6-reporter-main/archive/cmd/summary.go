@@ -0,0 +1,423 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// Decoding of the K6 end-of-test summary JSON, as written by --summary-export or handleSummary()
+// Two layouts exist in the wild, and both are normalised into the same typed structures:
+//  - legacy (k6 < v0.30) groups & checks are objects keyed by name, metric stats are flat and
+//    each threshold is a bare bool which is true when the threshold failed
+//  - current (k6 v0.30+) groups & checks are arrays, metric stats are under "values" along with
+//    the metric type, and each threshold is an object with an "ok" field
+
+// schemaVersion identifies which summary layout an input file uses
+type schemaVersion int
+
+const (
+	schemaCurrent schemaVersion = iota
+	schemaLegacy
+)
+
+func (s schemaVersion) String() string {
+	if s == schemaLegacy {
+		return "legacy (k6 < v0.30)"
+	}
+	return "current (k6 v0.30+)"
+}
+
+// DecodeError reports malformed input, along with the JSON path where the problem was found
+type DecodeError struct {
+	Path string
+	Err  error
+}
+
+func (e *DecodeError) Error() string {
+	return fmt.Sprintf("%s: %v", e.Path, e.Err)
+}
+
+func (e *DecodeError) Unwrap() error {
+	return e.Err
+}
+
+// metricKind is the type and value kind of a metric, e.g. trend & time
+type metricKind struct {
+	Type     string
+	Contains string
+}
+
+// Built-in K6 metrics, used when the input doesn't carry the metric type itself
+var builtinMetrics = map[string]metricKind{
+	"vus":                      {"gauge", "default"},
+	"vus_max":                  {"gauge", "default"},
+	"iterations":               {"counter", "default"},
+	"iteration_duration":       {"trend", "time"},
+	"dropped_iterations":       {"counter", "default"},
+	"checks":                   {"rate", "default"},
+	"group_duration":           {"trend", "time"},
+	"http_reqs":                {"counter", "default"},
+	"http_req_failed":          {"rate", "default"},
+	"http_req_duration":        {"trend", "time"},
+	"http_req_blocked":         {"trend", "time"},
+	"http_req_connecting":      {"trend", "time"},
+	"http_req_tls_handshaking": {"trend", "time"},
+	"http_req_sending":         {"trend", "time"},
+	"http_req_waiting":         {"trend", "time"},
+	"http_req_receiving":       {"trend", "time"},
+	"ws_sessions":              {"counter", "default"},
+	"ws_msgs_sent":             {"counter", "default"},
+	"ws_msgs_received":         {"counter", "default"},
+	"ws_ping":                  {"trend", "time"},
+	"ws_session_duration":      {"trend", "time"},
+	"ws_connecting":            {"trend", "time"},
+	"grpc_req_duration":        {"trend", "time"},
+	"data_sent":                {"counter", "data"},
+	"data_received":            {"counter", "data"},
+}
+
+// decodeSummary reads a K6 summary JSON document in either layout
+func decodeSummary(r io.Reader) (*ResultData, schemaVersion, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, schemaCurrent, err
+	}
+
+	var doc map[string]json.RawMessage
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, schemaCurrent, &DecodeError{Path: "$", Err: describeJSONError(data, err)}
+	}
+
+	schema, err := detectSchema(doc)
+	if err != nil {
+		return nil, schema, err
+	}
+
+	resultData := &ResultData{Metrics: map[string]Metric{}}
+
+	if raw, ok := doc["metrics"]; ok {
+		var metrics map[string]json.RawMessage
+		if err := decodeValue("$.metrics", raw, &metrics); err != nil {
+			return nil, schema, err
+		}
+		for name, rawMetric := range metrics {
+			metric, err := decodeMetric(fmt.Sprintf("$.metrics[%q]", name), name, rawMetric, schema)
+			if err != nil {
+				return nil, schema, err
+			}
+			resultData.Metrics[name] = metric
+		}
+	} else {
+		return nil, schema, &DecodeError{Path: "$", Err: errors.New("missing \"metrics\" key, is this a K6 summary file?")}
+	}
+
+	if raw, ok := doc["root_group"]; ok {
+		resultData.RootGroup, err = decodeGroup("$.root_group", raw, schema)
+		if err != nil {
+			return nil, schema, err
+		}
+	}
+
+	if raw, ok := doc["options"]; ok {
+		if err := decodeValue("$.options", raw, &resultData.Options); err != nil {
+			return nil, schema, err
+		}
+	}
+
+	if raw, ok := doc["state"]; ok {
+		if err := decodeValue("$.state", raw, &resultData.State); err != nil {
+			return nil, schema, err
+		}
+	}
+
+	return resultData, schema, nil
+}
+
+// detectSchema works out the layout from the shape of the groups & checks, falling back to the metrics
+func detectSchema(doc map[string]json.RawMessage) (schemaVersion, error) {
+	if raw, ok := doc["root_group"]; ok {
+		var group map[string]json.RawMessage
+		if err := decodeValue("$.root_group", raw, &group); err != nil {
+			return schemaCurrent, err
+		}
+		for _, key := range []string{"groups", "checks"} {
+			switch firstByte(group[key]) {
+			case '[':
+				return schemaCurrent, nil
+			case '{':
+				return schemaLegacy, nil
+			}
+		}
+	}
+
+	if _, ok := doc["options"]; ok {
+		return schemaCurrent, nil
+	}
+
+	var metrics map[string]map[string]json.RawMessage
+	if err := json.Unmarshal(doc["metrics"], &metrics); err == nil {
+		for _, metric := range metrics {
+			if _, ok := metric["values"]; ok {
+				return schemaCurrent, nil
+			}
+			return schemaLegacy, nil
+		}
+	}
+
+	return schemaCurrent, nil
+}
+
+// currentMetric is the current layout of a metric
+type currentMetric struct {
+	Type       string                     `json:"type"`
+	Contains   string                     `json:"contains"`
+	Values     map[string]json.RawMessage `json:"values"`
+	Thresholds map[string]json.RawMessage `json:"thresholds"`
+}
+
+// decodeMetric normalises a single metric, in either layout
+func decodeMetric(path, name string, raw json.RawMessage, schema schemaVersion) (Metric, error) {
+	metric := Metric{Name: name, Values: map[string]float64{}}
+
+	if schema == schemaCurrent {
+		cm := currentMetric{}
+		if err := decodeValue(path, raw, &cm); err != nil {
+			return metric, err
+		}
+		switch cm.Type {
+		case "counter", "gauge", "rate", "trend":
+		default:
+			return metric, &DecodeError{Path: path + ".type", Err: fmt.Errorf("unknown metric type %q", cm.Type)}
+		}
+		metric.Type = cm.Type
+		metric.Contains = cm.Contains
+		if metric.Contains == "" {
+			metric.Contains = "default"
+		}
+
+		for stat, rawValue := range cm.Values {
+			var value float64
+			if err := decodeValue(fmt.Sprintf("%s.values[%q]", path, stat), rawValue, &value); err != nil {
+				return metric, err
+			}
+			metric.Values[stat] = value
+		}
+
+		for source, rawThres := range cm.Thresholds {
+			var thres struct {
+				OK *bool `json:"ok"`
+			}
+			thresPath := fmt.Sprintf("%s.thresholds[%q]", path, source)
+			if err := decodeValue(thresPath, rawThres, &thres); err != nil {
+				return metric, err
+			}
+			if thres.OK == nil {
+				return metric, &DecodeError{Path: thresPath, Err: errors.New("missing \"ok\" field")}
+			}
+			metric.Thresholds = append(metric.Thresholds, Threshold{Source: source, OK: *thres.OK})
+		}
+	} else {
+		var fields map[string]json.RawMessage
+		if err := decodeValue(path, raw, &fields); err != nil {
+			return metric, err
+		}
+
+		for key, rawValue := range fields {
+			if key == "thresholds" {
+				var thresholds map[string]bool
+				if err := decodeValue(path+".thresholds", rawValue, &thresholds); err != nil {
+					return metric, err
+				}
+				for source, failed := range thresholds {
+					metric.Thresholds = append(metric.Thresholds, Threshold{Source: source, OK: !failed})
+				}
+				continue
+			}
+
+			var value float64
+			if err := decodeValue(fmt.Sprintf("%s[%q]", path, key), rawValue, &value); err != nil {
+				return metric, err
+			}
+			metric.Values[key] = value
+		}
+
+		kind, err := inferMetricKind(name, metric.Values)
+		if err != nil {
+			return metric, &DecodeError{Path: path, Err: err}
+		}
+		metric.Type = kind.Type
+		metric.Contains = kind.Contains
+
+		// Legacy rate metrics hold the rate in "value", the current layout calls it "rate"
+		if metric.Type == "rate" {
+			if value, ok := metric.Values["value"]; ok {
+				metric.Values["rate"] = value
+				delete(metric.Values, "value")
+			}
+		}
+	}
+
+	sort.Slice(metric.Thresholds, func(i, j int) bool {
+		return metric.Thresholds[i].Source < metric.Thresholds[j].Source
+	})
+
+	return metric, nil
+}
+
+// inferMetricKind works out the type of a legacy metric, which isn't stored in the file
+func inferMetricKind(name string, values map[string]float64) (metricKind, error) {
+	if kind, ok := builtinMetrics[baseMetricName(name)]; ok {
+		return kind, nil
+	}
+
+	has := func(key string) bool {
+		_, ok := values[key]
+		return ok
+	}
+	switch {
+	case has("passes") || has("fails"):
+		return metricKind{"rate", "default"}, nil
+	case has("count"):
+		return metricKind{"counter", "default"}, nil
+	case has("avg") || has("med"):
+		return metricKind{"trend", "default"}, nil
+	case has("value"):
+		return metricKind{"gauge", "default"}, nil
+	}
+	for key := range values {
+		if strings.HasPrefix(key, "p(") {
+			return metricKind{"trend", "default"}, nil
+		}
+	}
+
+	return metricKind{}, errors.New("unable to determine metric type from its values")
+}
+
+// baseMetricName strips any submetric tag selector, e.g. http_req_duration{status:200}
+func baseMetricName(name string) string {
+	if i := strings.Index(name, "{"); i > 0 {
+		return name[:i]
+	}
+	return name
+}
+
+// decodeGroup normalises a group and all of its sub-groups and checks, in either layout
+func decodeGroup(path string, raw json.RawMessage, schema schemaVersion) (Group, error) {
+	group := Group{}
+
+	var fields struct {
+		Name   string          `json:"name"`
+		Path   string          `json:"path"`
+		ID     string          `json:"id"`
+		Groups json.RawMessage `json:"groups"`
+		Checks json.RawMessage `json:"checks"`
+	}
+	if err := decodeValue(path, raw, &fields); err != nil {
+		return group, err
+	}
+	group.Name = fields.Name
+	group.Path = fields.Path
+	group.ID = fields.ID
+
+	groupsPath := path + ".groups"
+	err := decodeCollection(groupsPath, fields.Groups, schema, func(itemPath string, item json.RawMessage) error {
+		subGroup, err := decodeGroup(itemPath, item, schema)
+		group.Groups = append(group.Groups, subGroup)
+		return err
+	})
+	if err != nil {
+		return group, err
+	}
+
+	checksPath := path + ".checks"
+	err = decodeCollection(checksPath, fields.Checks, schema, func(itemPath string, item json.RawMessage) error {
+		check := Check{}
+		if err := decodeValue(itemPath, item, &check); err != nil {
+			return err
+		}
+		group.Checks = append(group.Checks, check)
+		return nil
+	})
+
+	return group, err
+}
+
+// decodeCollection walks the items of an array (current) or an object keyed by name (legacy)
+// Legacy objects are walked in name order, as there is no other ordering to preserve
+func decodeCollection(path string, raw json.RawMessage, schema schemaVersion, fn func(string, json.RawMessage) error) error {
+	if len(raw) == 0 || string(raw) == "null" {
+		return nil
+	}
+
+	if schema == schemaCurrent {
+		var items []json.RawMessage
+		if err := decodeValue(path, raw, &items); err != nil {
+			return err
+		}
+		for i, item := range items {
+			if err := fn(fmt.Sprintf("%s[%d]", path, i), item); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	var items map[string]json.RawMessage
+	if err := decodeValue(path, raw, &items); err != nil {
+		return err
+	}
+	names := make([]string, 0, len(items))
+	for name := range items {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if err := fn(fmt.Sprintf("%s[%q]", path, name), items[name]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// decodeValue unmarshals raw into v, attaching the JSON path to any error
+func decodeValue(path string, raw json.RawMessage, v interface{}) error {
+	if err := json.Unmarshal(raw, v); err != nil {
+		var typeErr *json.UnmarshalTypeError
+		if errors.As(err, &typeErr) {
+			if typeErr.Field != "" {
+				path = path + "." + typeErr.Field
+			}
+			err = fmt.Errorf("expected %s but found JSON %s", typeErr.Type, typeErr.Value)
+		}
+		return &DecodeError{Path: path, Err: err}
+	}
+	return nil
+}
+
+// describeJSONError adds the line & column to syntax errors, byte offsets aren't much use to people
+func describeJSONError(data []byte, err error) error {
+	var syntaxErr *json.SyntaxError
+	if !errors.As(err, &syntaxErr) {
+		return err
+	}
+
+	before := data[:syntaxErr.Offset]
+	line := bytes.Count(before, []byte("\n")) + 1
+	column := len(before) - bytes.LastIndexByte(before, '\n')
+	return fmt.Errorf("line %d, column %d: %w", line, column, err)
+}
+
+// firstByte returns the first non whitespace byte of a JSON value
+func firstByte(raw json.RawMessage) byte {
+	trimmed := bytes.TrimSpace(raw)
+	if len(trimmed) == 0 {
+		return 0
+	}
+	return trimmed[0]
+}
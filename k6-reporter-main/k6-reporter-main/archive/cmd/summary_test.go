@@ -0,0 +1,122 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+)
+
+const currentSummary = `{
+  "root_group": {"name": "", "path": "", "id": "1", "groups": [
+    {"name": "kasir", "path": "::kasir", "id": "2", "groups": [], "checks": [
+      {"name": "status is 200", "path": "::kasir::status is 200", "id": "3", "passes": 9, "fails": 1}
+    ]}
+  ], "checks": []},
+  "options": {"summaryTrendStats": ["avg", "p(95)"]},
+  "metrics": {
+    "http_req_duration": {"type": "trend", "contains": "time", "values": {"avg": 20, "p(95)": 45},
+      "thresholds": {"p(95)<40": {"ok": false}, "avg<50": {"ok": true}}},
+    "http_req_failed": {"type": "rate", "values": {"rate": 0.1, "passes": 1, "fails": 9}}
+  }
+}`
+
+const legacySummary = `{
+  "root_group": {"name": "", "path": "", "id": "1", "groups": {
+    "kasir": {"name": "kasir", "path": "::kasir", "id": "2", "groups": {}, "checks": {
+      "status is 200": {"name": "status is 200", "path": "::kasir::status is 200", "id": "3", "passes": 9, "fails": 1}
+    }}
+  }, "checks": {}},
+  "metrics": {
+    "http_req_duration": {"avg": 20, "p(95)": 45, "thresholds": {"p(95)<40": true, "avg<50": false}},
+    "http_req_failed": {"value": 0.1, "passes": 1, "fails": 9}
+  }
+}`
+
+func TestDetectSchema(t *testing.T) {
+	tests := []struct {
+		name string
+		doc  string
+		want schemaVersion
+	}{
+		{"current groups", currentSummary, schemaCurrent},
+		{"legacy groups", legacySummary, schemaLegacy},
+		{"current without groups", `{"options": {}, "metrics": {}}`, schemaCurrent},
+		{"current metrics only", `{"metrics": {"vus": {"type": "gauge", "values": {"value": 1}}}}`, schemaCurrent},
+		{"legacy metrics only", `{"metrics": {"vus": {"value": 1, "min": 1, "max": 1}}}`, schemaLegacy},
+		{"empty groups", `{"root_group": {"groups": null, "checks": null}, "metrics": {"vus": {"value": 1}}}`, schemaLegacy},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var doc map[string]json.RawMessage
+			if err := json.Unmarshal([]byte(test.doc), &doc); err != nil {
+				t.Fatal(err)
+			}
+			got, err := detectSchema(doc)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != test.want {
+				t.Errorf("got %s, want %s", got, test.want)
+			}
+		})
+	}
+}
+
+func TestDecodeSummary(t *testing.T) {
+	for _, doc := range []string{currentSummary, legacySummary} {
+		resultData, schema, err := decodeSummary(strings.NewReader(doc))
+		if err != nil {
+			t.Fatalf("%s: %v", schema, err)
+		}
+
+		duration := resultData.Metrics["http_req_duration"]
+		if duration.Type != "trend" || duration.Values["p(95)"] != 45 {
+			t.Errorf("%s: got http_req_duration %+v", schema, duration)
+		}
+		want := []Threshold{{Source: "avg<50", OK: true}, {Source: "p(95)<40", OK: false}}
+		if len(duration.Thresholds) != len(want) {
+			t.Fatalf("%s: got thresholds %+v, want %+v", schema, duration.Thresholds, want)
+		}
+		for i := range want {
+			if duration.Thresholds[i] != want[i] {
+				t.Errorf("%s: got threshold %+v, want %+v", schema, duration.Thresholds[i], want[i])
+			}
+		}
+
+		failed := resultData.Metrics["http_req_failed"]
+		if failed.Type != "rate" || failed.Values["rate"] != 0.1 {
+			t.Errorf("%s: got http_req_failed %+v", schema, failed)
+		}
+
+		groups := resultData.RootGroup.Groups
+		if len(groups) != 1 || len(groups[0].Checks) != 1 || groups[0].Checks[0].Passes != 9 {
+			t.Errorf("%s: got groups %+v", schema, groups)
+		}
+	}
+}
+
+func TestDecodeSummaryErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		doc  string
+		path string
+	}{
+		{"no metrics", `{"root_group": {"groups": [], "checks": []}}`, "$"},
+		{"unknown type", `{"metrics": {"vus": {"type": "histogram", "values": {}}}}`, `$.metrics["vus"].type`},
+		{"threshold without ok", `{"metrics": {"vus": {"type": "gauge", "values": {}, "thresholds": {"value<5": {}}}}}`, `$.metrics["vus"].thresholds["value<5"]`},
+		{"unknown legacy metric", `{"metrics": {"custom": {"foo": 1}}}`, `$.metrics["custom"]`},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, _, err := decodeSummary(strings.NewReader(test.doc))
+			var decodeErr *DecodeError
+			if !errors.As(err, &decodeErr) {
+				t.Fatalf("got %v, want a DecodeError", err)
+			}
+			if decodeErr.Path != test.path {
+				t.Errorf("got path %s, want %s", decodeErr.Path, test.path)
+			}
+		})
+	}
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Threshold expressions are parsed following the same grammar as K6 itself, see metrics/thresholds_parser.go
+//  assertion           -> aggregation_method whitespace* operator whitespace* float
+//  aggregation_method  -> trend | rate | gauge | counter
+//  counter             -> "count" | "rate"
+//  gauge               -> "value"
+//  rate                -> "rate"
+//  trend               -> "avg" | "min" | "max" | "med" | percentile
+//  percentile          -> "p(" float ")"
+//  operator            -> ">" | ">=" | "<=" | "<" | "==" | "===" | "!="
+
+// thresholdExpression is a parsed threshold expression, e.g. "p(95)<500"
+type thresholdExpression struct {
+	AggregationMethod string  // One of the aggregationMethodTokens
+	AggregationValue  float64 // The percentile, only used when AggregationMethod is "p"
+	Operator          string  // One of the operatorTokens
+	Value             float64
+}
+
+// Longer operators must come before shorter ones they share symbols with, e.g. "<=" before "<"
+var operatorTokens = []string{"<=", "<", ">=", ">", "===", "==", "!="}
+
+// Aggregation methods, the percentile token "p" is handled separately as it takes a value
+var aggregationMethodTokens = []string{"value", "count", "rate", "avg", "min", "med", "max"}
+
+// parseThresholdExpression parses a threshold expression of the form `aggregation_method operator value`
+func parseThresholdExpression(input string) (*thresholdExpression, error) {
+	method, operator, value, err := scanThresholdExpression(input)
+	if err != nil {
+		return nil, fmt.Errorf("failed parsing threshold expression %q: %w", input, err)
+	}
+
+	expr := &thresholdExpression{Operator: operator}
+	expr.AggregationMethod, expr.AggregationValue, err = parseThresholdAggregationMethod(method)
+	if err != nil {
+		return nil, fmt.Errorf("failed parsing threshold expression %q left hand side: %w", input, err)
+	}
+
+	expr.Value, err = strconv.ParseFloat(value, 64)
+	if err != nil {
+		return nil, fmt.Errorf("failed parsing threshold expression %q right hand side: %w", input, err)
+	}
+
+	return expr, nil
+}
+
+// scanThresholdExpression splits an expression on its operator, without checking either side
+func scanThresholdExpression(input string) (string, string, string, error) {
+	for _, op := range operatorTokens {
+		i := strings.Index(input, op)
+		if i < 0 {
+			continue
+		}
+		if right := input[i+len(op):]; right != "" {
+			return strings.TrimSpace(input[:i]), op, strings.TrimSpace(right), nil
+		}
+	}
+
+	return "", "", "", errors.New("malformed threshold expression")
+}
+
+// parseThresholdAggregationMethod parses the left hand side, e.g. "avg" or "p(99.9)"
+func parseThresholdAggregationMethod(input string) (string, float64, error) {
+	for _, m := range aggregationMethodTokens {
+		if m == input {
+			return m, 0, nil
+		}
+	}
+
+	if strings.HasPrefix(input, "p(") && strings.HasSuffix(input, ")") {
+		value, err := strconv.ParseFloat(strings.TrimSuffix(strings.TrimPrefix(input, "p("), ")"), 64)
+		if err != nil {
+			return "", 0, fmt.Errorf("malformed percentile value: %w", err)
+		}
+		return "p", value, nil
+	}
+
+	return "", 0, errors.New("failed parsing method from expression")
+}
+
+// SinkKey is the name of the metric stat the expression applies to, e.g. "avg" or "p(99.9)"
+func (te *thresholdExpression) SinkKey() string {
+	if te.AggregationMethod == "p" {
+		return percentileStat(te.AggregationValue)
+	}
+	return te.AggregationMethod
+}
+
+// Passes reports whether an observed value satisfies the expression
+func (te *thresholdExpression) Passes(observed float64) bool {
+	switch te.Operator {
+	case "<=":
+		return observed <= te.Value
+	case "<":
+		return observed < te.Value
+	case ">=":
+		return observed >= te.Value
+	case ">":
+		return observed > te.Value
+	case "===", "==":
+		return observed == te.Value
+	case "!=":
+		return observed != te.Value
+	}
+	return false
+}
+
+// percentileStat formats a percentile stat name the same way K6 does, e.g. "p(95)" or "p(99.9)"
+func percentileStat(pct float64) string {
+	return fmt.Sprintf("p(%g)", pct)
+}
+
+// observedValue finds the metric stat a threshold expression was evaluated against
+// The stat isn't always there, e.g. a summary without the percentile in summaryTrendStats
+func observedValue(metric Metric, source string) (*thresholdExpression, float64, bool, error) {
+	expr, err := parseThresholdExpression(source)
+	if err != nil {
+		return nil, 0, false, err
+	}
+	value, ok := metric.Values[expr.SinkKey()]
+	return expr, value, ok, nil
+}
+
+// ThresholdResult is a single threshold of a metric or submetric, with how close the observed value came to the limit
+type ThresholdResult struct {
+	Metric      string  // Metric or submetric name, e.g. http_req_duration{expected_response:true}
+	Source      string  // The expression as written, e.g. "p(95)<500"
+	Stat        string  // The aggregation the expression is evaluated on, e.g. "p(95)", "rate" or "count"
+	Operator    string  // One of <, <=, >, >=, ==, === or !=
+	Target      float64 // The limit on the right hand side of the expression
+	Observed    float64
+	HasObserved bool    // False when the stat isn't in the results, e.g. a summary without it in summaryTrendStats
+	Margin      float64 // Distance from observed to the limit, positive is inside the limit & negative is over it
+	MarginPct   float64 // Margin as a percentage of the target, zero when the target is zero
+	OK          bool
+	AbortOnFail bool
+	Error       string // Set when the expression can't be parsed
+}
+
+// evaluateThresholds lists the result of every threshold, and counts the total & how many failed
+func evaluateThresholds(resultData *ResultData) {
+	resultData.Thresholds = []ThresholdResult{}
+	resultData.ThresholdFailures = 0
+
+	for _, name := range sortedMetricNames(resultData.Metrics) {
+		metric := resultData.Metrics[name]
+		for _, thres := range metric.Thresholds {
+			result := ThresholdResult{Metric: name, Source: thres.Source, OK: thres.OK, AbortOnFail: thres.AbortOnFail}
+			expr, observed, ok, err := observedValue(metric, thres.Source)
+			if err != nil {
+				result.Error = err.Error()
+			} else {
+				result.Stat, result.Operator, result.Target = expr.SinkKey(), expr.Operator, expr.Value
+				result.Observed, result.HasObserved = observed, ok
+				if ok {
+					result.Margin = expr.Margin(observed)
+					if expr.Value != 0 {
+						result.MarginPct = result.Margin / math.Abs(expr.Value) * 100
+					}
+				}
+			}
+
+			if !thres.OK {
+				resultData.ThresholdFailures++
+			}
+			resultData.Thresholds = append(resultData.Thresholds, result)
+		}
+	}
+
+	resultData.ThresholdTotal = len(resultData.Thresholds)
+}
+
+// Margin is how far an observed value is inside the limit, or negative when it's over it
+func (te *thresholdExpression) Margin(observed float64) float64 {
+	switch te.Operator {
+	case "<=", "<":
+		return te.Value - observed
+	case ">=", ">":
+		return observed - te.Value
+	case "===", "==":
+		return -math.Abs(observed - te.Value)
+	case "!=":
+		return math.Abs(observed - te.Value)
+	}
+	return 0
+}
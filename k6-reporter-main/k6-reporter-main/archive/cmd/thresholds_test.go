@@ -0,0 +1,152 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestParseThresholdExpression(t *testing.T) {
+	tests := []struct {
+		input string
+		want  thresholdExpression
+		stat  string
+	}{
+		{"p(95)<500", thresholdExpression{"p", 95, "<", 500}, "p(95)"},
+		{"p(99.9) <= 1000", thresholdExpression{"p", 99.9, "<=", 1000}, "p(99.9)"},
+		{"avg<50", thresholdExpression{"avg", 0, "<", 50}, "avg"},
+		{"med>=1.5", thresholdExpression{"med", 0, ">=", 1.5}, "med"},
+		{"rate<0.01", thresholdExpression{"rate", 0, "<", 0.01}, "rate"},
+		{"count>10", thresholdExpression{"count", 0, ">", 10}, "count"},
+		{"value===5", thresholdExpression{"value", 0, "===", 5}, "value"},
+		{"value==5", thresholdExpression{"value", 0, "==", 5}, "value"},
+		{"max!=0", thresholdExpression{"max", 0, "!=", 0}, "max"},
+		{"min > -1", thresholdExpression{"min", 0, ">", -1}, "min"},
+	}
+	for _, test := range tests {
+		t.Run(test.input, func(t *testing.T) {
+			got, err := parseThresholdExpression(test.input)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if *got != test.want {
+				t.Errorf("got %+v, want %+v", *got, test.want)
+			}
+			if got.SinkKey() != test.stat {
+				t.Errorf("got stat %s, want %s", got.SinkKey(), test.stat)
+			}
+		})
+	}
+}
+
+func TestParseThresholdExpressionErrors(t *testing.T) {
+	for _, input := range []string{
+		"",
+		"p(95)",
+		"p(95)<",
+		"<500",
+		"avgs<500",
+		"p95<500",
+		"p(abc)<500",
+		"avg<fast",
+		"avg=500",
+	} {
+		t.Run(input, func(t *testing.T) {
+			if expr, err := parseThresholdExpression(input); err == nil {
+				t.Errorf("got %+v, want an error", *expr)
+			}
+		})
+	}
+}
+
+func TestThresholdPassesAndMargin(t *testing.T) {
+	tests := []struct {
+		input    string
+		observed float64
+		passes   bool
+		margin   float64
+	}{
+		{"p(95)<500", 400, true, 100},
+		{"p(95)<500", 500, false, 0},
+		{"p(95)<=500", 500, true, 0},
+		{"p(95)<500", 650, false, -150},
+		{"count>10", 12, true, 2},
+		{"count>=10", 8, false, -2},
+		{"value==5", 5, true, 0},
+		{"value===5", 7, false, -2},
+		{"rate!=0", 0.25, true, 0.25},
+		{"rate!=0", 0, false, 0},
+	}
+	for _, test := range tests {
+		expr, err := parseThresholdExpression(test.input)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := expr.Passes(test.observed); got != test.passes {
+			t.Errorf("%s with %g: got passes %v, want %v", test.input, test.observed, got, test.passes)
+		}
+		if got := expr.Margin(test.observed); got != test.margin {
+			t.Errorf("%s with %g: got margin %g, want %g", test.input, test.observed, got, test.margin)
+		}
+	}
+}
+
+func TestEvaluateThresholds(t *testing.T) {
+	resultData := &ResultData{Metrics: map[string]Metric{
+		"http_req_duration": {Type: "trend", Values: map[string]float64{"p(95)": 450, "avg": 120}, Thresholds: []Threshold{
+			{Source: "p(95)<500", OK: true},
+			{Source: "p(99)<900", OK: true},
+		}},
+		"http_req_failed": {Type: "rate", Values: map[string]float64{"rate": 0.02}, Thresholds: []Threshold{
+			{Source: "rate<0.01", OK: false, AbortOnFail: true},
+			{Source: "rate<<1", OK: true},
+		}},
+	}}
+	evaluateThresholds(resultData)
+
+	if resultData.ThresholdTotal != 4 || resultData.ThresholdFailures != 1 {
+		t.Fatalf("got %d thresholds & %d failures, want 4 & 1", resultData.ThresholdTotal, resultData.ThresholdFailures)
+	}
+	byMetric := resultData.Thresholds
+	if byMetric[0].Metric != "http_req_duration" || byMetric[2].Metric != "http_req_failed" {
+		t.Errorf("thresholds not sorted by metric, got %+v", byMetric)
+	}
+
+	p95 := byMetric[0]
+	if !p95.HasObserved || p95.Observed != 450 || p95.Margin != 50 || p95.MarginPct != 10 {
+		t.Errorf("got p(95) %+v", p95)
+	}
+	if p99 := byMetric[1]; p99.HasObserved || p99.Stat != "p(99)" {
+		t.Errorf("got p(99) %+v, want no observed value", p99)
+	}
+	if rate := byMetric[2]; rate.OK || !rate.AbortOnFail || rate.Margin >= 0 {
+		t.Errorf("got rate %+v, want a failure over the limit", rate)
+	}
+	if malformed := byMetric[3]; malformed.Error == "" {
+		t.Errorf("got %+v, want a parse error", malformed)
+	}
+}
+
+func TestThresholdMarginPct(t *testing.T) {
+	tests := []struct {
+		source    string
+		values    map[string]float64
+		margin    float64
+		marginPct float64
+	}{
+		{"p(95)<500", map[string]float64{"p(95)": 450}, 50, 10},
+		{"p(95)<500", map[string]float64{"p(95)": 750}, -250, -50},
+		{"count>=200", map[string]float64{"count": 150}, -50, -25},
+		{"value>-20", map[string]float64{"value": -10}, 10, 50},
+		{"count==0", map[string]float64{"count": 3}, -3, 0},
+		{"rate<0.05", map[string]float64{}, 0, 0},
+	}
+	for _, test := range tests {
+		t.Run(test.source, func(t *testing.T) {
+			resultData := &ResultData{Metrics: map[string]Metric{"m": {Values: test.values, Thresholds: []Threshold{{Source: test.source, OK: true}}}}}
+			evaluateThresholds(resultData)
+			got := resultData.Thresholds[0]
+			if got.Margin != test.margin || got.MarginPct != test.marginPct {
+				t.Errorf("got margin %v & %v%%, want %v & %v%%", got.Margin, got.MarginPct, test.margin, test.marginPct)
+			}
+		})
+	}
+}
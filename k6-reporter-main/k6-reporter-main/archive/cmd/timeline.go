@@ -0,0 +1,266 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// Raw sample inputs are also recorded over time, to chart the shape of a test, e.g. ramp up, plateau & ramp down
+// Samples go into one second slots as they're read, which are merged into buckets of the chosen size at the end
+
+// Bucket sizes picked from when the size isn't given, the smallest giving at most maxTimelineBuckets is used
+var timelineBucketSizes = []time.Duration{
+	time.Second, 2 * time.Second, 5 * time.Second, 10 * time.Second, 15 * time.Second, 30 * time.Second,
+	time.Minute, 2 * time.Minute, 5 * time.Minute, 10 * time.Minute, 15 * time.Minute, 30 * time.Minute, time.Hour,
+}
+
+const maxTimelineBuckets = 120
+
+// Timeline is how a test went over time
+type Timeline struct {
+	BucketMs float64 // Size of each bucket
+	Buckets  []TimelineBucket
+}
+
+// TimelineBucket totals the samples in a slice of time
+type TimelineBucket struct {
+	Time          time.Time
+	DurationMs    float64 `json:",omitempty"` // Time covered, less than the bucket size when the test ended part way through
+	VUs           float64 // Most active VUs
+	Requests      float64 // http_reqs
+	Iterations    float64 // iterations
+	Dropped       float64 // dropped_iterations
+	P50           float64 // Percentiles of http_req_duration
+	P95           float64
+	P99           float64
+	Failed        float64 // Failed http_req_failed samples, out of FailedSamples
+	FailedSamples float64
+	CheckPasses   float64 // Passed checks, out of Checks
+	Checks        float64
+	Errors        map[string]float64 `json:",omitempty"` // Requests with an error class, keyed by class e.g. 5xx
+}
+
+// timelineRecorder collects the samples charted over time, keyed by unix second
+type timelineRecorder struct {
+	slots map[int64]*timelineSlot
+}
+
+type timelineSlot struct {
+	bucket    TimelineBucket
+	hasVUs    bool
+	durations []float64
+}
+
+func newTimelineRecorder() *timelineRecorder {
+	return &timelineRecorder{slots: map[int64]*timelineSlot{}}
+}
+
+// add records a sample, if it's of a metric that's charted
+func (t *timelineRecorder) add(s sample) {
+	switch s.Metric {
+	case "vus", "http_reqs", "http_req_duration", "http_req_failed", "checks", "iterations", "dropped_iterations":
+	default:
+		return
+	}
+
+	key := s.Time.Unix()
+	slot, ok := t.slots[key]
+	if !ok {
+		slot = &timelineSlot{}
+		t.slots[key] = slot
+	}
+	bucket := &slot.bucket
+
+	switch s.Metric {
+	case "vus":
+		if !slot.hasVUs || s.Value > bucket.VUs {
+			bucket.VUs = s.Value
+		}
+		slot.hasVUs = true
+	case "http_reqs":
+		bucket.Requests += s.Value
+		if status, ok := s.Tags["status"]; ok {
+			if class := statusClass(status); isErrorClass(class) {
+				if bucket.Errors == nil {
+					bucket.Errors = map[string]float64{}
+				}
+				bucket.Errors[class] += s.Value
+			}
+		}
+	case "iterations":
+		bucket.Iterations += s.Value
+	case "dropped_iterations":
+		bucket.Dropped += s.Value
+	case "http_req_duration":
+		slot.durations = append(slot.durations, s.Value)
+	case "http_req_failed":
+		bucket.FailedSamples++
+		if s.Value != 0 {
+			bucket.Failed++
+		}
+	case "checks":
+		bucket.Checks++
+		if s.Value != 0 {
+			bucket.CheckPasses++
+		}
+	}
+}
+
+// timeline merges the slots into buckets, a size of 0 picks one from the length of the test
+// VUs are carried over buckets with no vus samples, as K6 only writes them when they're sampled
+func (t *timelineRecorder) timeline(size time.Duration) *Timeline {
+	if len(t.slots) == 0 {
+		return nil
+	}
+	keys := make([]int64, 0, len(t.slots))
+	for key := range t.slots {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i] < keys[j] })
+	first, last := keys[0], keys[len(keys)-1]
+
+	if size <= 0 {
+		size = timelineBucketSize(time.Duration(last-first+1) * time.Second)
+	}
+	step := int64(size / time.Second)
+	if step < 1 {
+		step = 1
+	}
+
+	timeline := &Timeline{BucketMs: float64(step * 1000), Buckets: make([]TimelineBucket, (last-first)/step+1)}
+	hasVUs := make([]bool, len(timeline.Buckets))
+	durations := make([][]float64, len(timeline.Buckets))
+	for i := range timeline.Buckets {
+		start := first + int64(i)*step
+		timeline.Buckets[i].Time = time.Unix(start, 0).UTC()
+		covered := last + 1 - start
+		if covered > step {
+			covered = step
+		}
+		timeline.Buckets[i].DurationMs = float64(covered * 1000)
+	}
+	for _, key := range keys {
+		i := (key - first) / step
+		slot, bucket := t.slots[key], &timeline.Buckets[i]
+		if slot.hasVUs && (!hasVUs[i] || slot.bucket.VUs > bucket.VUs) {
+			bucket.VUs = slot.bucket.VUs
+			hasVUs[i] = true
+		}
+		bucket.Requests += slot.bucket.Requests
+		bucket.Iterations += slot.bucket.Iterations
+		bucket.Dropped += slot.bucket.Dropped
+		bucket.Failed += slot.bucket.Failed
+		bucket.FailedSamples += slot.bucket.FailedSamples
+		bucket.CheckPasses += slot.bucket.CheckPasses
+		bucket.Checks += slot.bucket.Checks
+		for class, count := range slot.bucket.Errors {
+			if bucket.Errors == nil {
+				bucket.Errors = map[string]float64{}
+			}
+			bucket.Errors[class] += count
+		}
+		durations[i] = append(durations[i], slot.durations...)
+	}
+
+	for i := range timeline.Buckets {
+		bucket := &timeline.Buckets[i]
+		if !hasVUs[i] && i > 0 {
+			bucket.VUs = timeline.Buckets[i-1].VUs
+		}
+		sort.Float64s(durations[i])
+		bucket.P50 = sortedPercentile(durations[i], 0.50)
+		bucket.P95 = sortedPercentile(durations[i], 0.95)
+		bucket.P99 = sortedPercentile(durations[i], 0.99)
+	}
+	return timeline
+}
+
+// bucketSeconds is the time a bucket covers, the bucket size for timelines stored before it was recorded
+func (t *Timeline) bucketSeconds(bucket TimelineBucket) float64 {
+	if bucket.DurationMs > 0 {
+		return bucket.DurationMs / 1000
+	}
+	return t.BucketMs / 1000
+}
+
+// timelineBucketSize picks a round bucket size for a test of the given length
+func timelineBucketSize(length time.Duration) time.Duration {
+	for _, size := range timelineBucketSizes {
+		if length/size <= maxTimelineBuckets {
+			return size
+		}
+	}
+	return timelineBucketSizes[len(timelineBucketSizes)-1]
+}
+
+// timelineCharts draws the charts of a timeline, charts with nothing to show are left out
+func timelineCharts(locale *Locale, timeline *Timeline) []Chart {
+	if timeline == nil || len(timeline.Buckets) == 0 {
+		return nil
+	}
+	start := timeline.Buckets[0].Time
+	elapsed := func(x float64) string {
+		return fmt.Sprint(time.Duration(x * float64(time.Second)).Round(time.Second))
+	}
+	count := func(v float64) string { return locale.FormatNumber(v, 0) }
+	milliseconds := func(v float64) string { return formatMs(locale, v) }
+	percentage := func(v float64) string { return locale.FormatNumber(v*100, 1) + "%" }
+	perSecond := func(v float64) string { return locale.FormatNumber(v, 1) + "/s" }
+
+	// series picks a value from every bucket, buckets where the value isn't known are skipped
+	series := func(name string, format func(float64) string, value func(TimelineBucket) (float64, bool)) chartSeries {
+		s := chartSeries{Name: name}
+		for _, bucket := range timeline.Buckets {
+			if y, ok := value(bucket); ok {
+				x := bucket.Time.Sub(start).Seconds()
+				s.Points = append(s.Points, chartPoint{X: x, Y: y, Label: elapsed(x) + ": " + format(y)})
+			}
+		}
+		return s
+	}
+
+	charts := []Chart{}
+	add := func(title string, format func(float64) string, lines ...chartSeries) {
+		for _, line := range lines {
+			if len(line.Points) > 0 {
+				charts = append(charts, Chart{Title: title, SVG: lineChart(title, lines, format, elapsed)})
+				return
+			}
+		}
+	}
+
+	hasVUs, hasRequests := false, false
+	for _, bucket := range timeline.Buckets {
+		hasVUs = hasVUs || bucket.VUs > 0
+		hasRequests = hasRequests || bucket.Requests > 0
+	}
+	add(locale.T("activeVUs"), count, series(locale.T("vus"), count, func(b TimelineBucket) (float64, bool) {
+		return b.VUs, hasVUs
+	}))
+	add(locale.T("rps"), perSecond, series(locale.T("http_reqs"), perSecond, func(b TimelineBucket) (float64, bool) {
+		return b.Requests / timeline.bucketSeconds(b), hasRequests
+	}))
+	latency := []chartSeries{}
+	for _, p := range []struct {
+		stat  string
+		value func(TimelineBucket) float64
+	}{
+		{"p(50)", func(b TimelineBucket) float64 { return b.P50 }},
+		{"p(95)", func(b TimelineBucket) float64 { return b.P95 }},
+		{"p(99)", func(b TimelineBucket) float64 { return b.P99 }},
+	} {
+		value := p.value
+		latency = append(latency, series(statLabel(locale, p.stat), milliseconds, func(b TimelineBucket) (float64, bool) {
+			return value(b), value(b) > 0
+		}))
+	}
+	add(locale.T("latency"), milliseconds, latency...)
+	add(locale.T("errorRate"), percentage, series(locale.T("http_req_failed"), percentage, func(b TimelineBucket) (float64, bool) {
+		return b.Failed / b.FailedSamples, b.FailedSamples > 0
+	}))
+	add(locale.T("checkPassRate"), percentage, series(locale.T("checks"), percentage, func(b TimelineBucket) (float64, bool) {
+		return b.CheckPasses / b.Checks, b.Checks > 0
+	}))
+	return charts
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTimelinePartialBucket(t *testing.T) {
+	start := time.Date(2025, 1, 1, 3, 0, 0, 0, time.UTC)
+	recorder := newTimelineRecorder()
+	// 10 requests a second for 25 seconds, the last 10s bucket is cut short after 5s
+	for second := 0; second < 25; second++ {
+		for i := 0; i < 10; i++ {
+			recorder.add(sample{Metric: "http_reqs", Time: start.Add(time.Duration(second) * time.Second), Value: 1})
+		}
+	}
+
+	timeline := recorder.timeline(10 * time.Second)
+	if timeline.BucketMs != 10000 || len(timeline.Buckets) != 3 {
+		t.Fatalf("got %gms buckets & %d buckets, want 10000ms & 3", timeline.BucketMs, len(timeline.Buckets))
+	}
+	for i, want := range []float64{10000, 10000, 5000} {
+		bucket := timeline.Buckets[i]
+		if bucket.DurationMs != want {
+			t.Errorf("bucket %d: got %gms, want %gms", i, bucket.DurationMs, want)
+		}
+		if rps := bucket.Requests / timeline.bucketSeconds(bucket); rps != 10 {
+			t.Errorf("bucket %d: got %g requests/s, want 10", i, rps)
+		}
+	}
+
+	// Timelines stored before the covered time was recorded fall back to the bucket size
+	if seconds := timeline.bucketSeconds(TimelineBucket{}); seconds != 10 {
+		t.Errorf("got %gs for a bucket without a duration, want 10s", seconds)
+	}
+}
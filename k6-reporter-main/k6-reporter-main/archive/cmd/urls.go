@@ -0,0 +1,92 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// URLs of endpoints are normalised so URLs with IDs in them, e.g. /shipment/detail/12345, don't each get a row
+//  1. The query string is stripped, unless keepQuery is set
+//  2. Each rewrite rule is applied in order, e.g. {"match": "/shipment/detail/[^/]+", "replace": "/shipment/detail/{code}"}
+//  3. Path segments that are numbers, UUIDs or hex hashes become {id}, {uuid} & {hash}, unless keepIds is set
+// Only URLs are normalised, requests the script named with a name tag are left as they are
+
+var (
+	numericSegment = regexp.MustCompile(`^[0-9]+$`)
+	uuidSegment    = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+	hashSegment    = regexp.MustCompile(`^[0-9a-fA-F]{16,}$`) // e.g. MD5, SHA & Mongo object IDs, long enough to never be a word
+)
+
+// urlRules is a URL rule file, given with -urlrules
+type urlRules struct {
+	Rewrites  []urlRewrite `json:"rewrites"`
+	KeepQuery bool         `json:"keepQuery"`
+	KeepIDs   bool         `json:"keepIds"`
+}
+
+// urlRewrite replaces matches of a regular expression, the replacement can use $1 etc for capture groups
+type urlRewrite struct {
+	Match   string `json:"match"`
+	Replace string `json:"replace"`
+	pattern *regexp.Regexp
+}
+
+// loadURLRules reads and compiles a rule file, unknown fields are an error so typos don't go unnoticed
+func loadURLRules(filename string) (*urlRules, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	rules := &urlRules{}
+	decoder := json.NewDecoder(file)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(rules); err != nil {
+		return nil, err
+	}
+	for i := range rules.Rewrites {
+		if rules.Rewrites[i].pattern, err = regexp.Compile(rules.Rewrites[i].Match); err != nil {
+			return nil, &DecodeError{Path: fmt.Sprintf("$.rewrites[%d].match", i), Err: err}
+		}
+	}
+	return rules, nil
+}
+
+// normalise turns a URL into the template it's shown as, a nil rule set has the defaults
+func (r *urlRules) normalise(url string) string {
+	if r == nil {
+		r = &urlRules{}
+	}
+	if !r.KeepQuery {
+		if i := strings.IndexAny(url, "?#"); i >= 0 {
+			url = url[:i]
+		}
+	}
+	for _, rewrite := range r.Rewrites {
+		url = rewrite.pattern.ReplaceAllString(url, rewrite.Replace)
+	}
+	if !r.KeepIDs {
+		// Only the path has segments, a kept query is put back after them
+		path, query := url, ""
+		if i := strings.IndexAny(url, "?#"); i >= 0 {
+			path, query = url[:i], url[i:]
+		}
+		segments := strings.Split(path, "/")
+		for i, segment := range segments {
+			switch {
+			case numericSegment.MatchString(segment):
+				segments[i] = "{id}"
+			case uuidSegment.MatchString(segment):
+				segments[i] = "{uuid}"
+			case hashSegment.MatchString(segment):
+				segments[i] = "{hash}"
+			}
+		}
+		url = strings.Join(segments, "/") + query
+	}
+	return url
+}
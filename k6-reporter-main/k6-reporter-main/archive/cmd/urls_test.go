@@ -0,0 +1,75 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+)
+
+func TestNormaliseURL(t *testing.T) {
+	custom := &urlRules{Rewrites: []urlRewrite{
+		{Match: `/shipment/detail/[^/]+`, Replace: "/shipment/detail/{code}"},
+		{Match: `/v[0-9]+/`, Replace: "/"},
+	}}
+	for i := range custom.Rewrites {
+		custom.Rewrites[i].pattern = regexp.MustCompile(custom.Rewrites[i].Match)
+	}
+
+	tests := []struct {
+		name  string
+		rules *urlRules
+		url   string
+		want  string
+	}{
+		{"no ids", nil, "https://tms.example.com/login/", "https://tms.example.com/login/"},
+		{"numeric", nil, "https://tms.example.com/order/12345/items/6", "https://tms.example.com/order/{id}/items/{id}"},
+		{"numeric in a word", nil, "https://tms.example.com/v2/report2024", "https://tms.example.com/v2/report2024"},
+		{"uuid", nil, "https://tms.example.com/user/3F2504E0-4F89-11D3-9A0C-0305E82C3301", "https://tms.example.com/user/{uuid}"},
+		{"hash", nil, "https://tms.example.com/blob/9e107d9d372bb6826bd81d3542a419d6", "https://tms.example.com/blob/{hash}"},
+		{"short hex is a word", nil, "https://tms.example.com/cafe/facade", "https://tms.example.com/cafe/facade"},
+		{"query", nil, "https://tms.example.com/search?from=2025-01-01&to=2025-01-31", "https://tms.example.com/search"},
+		{"fragment", nil, "https://tms.example.com/order/12#items", "https://tms.example.com/order/{id}"},
+		{"query then fragment", nil, "https://tms.example.com/list?page=2#top", "https://tms.example.com/list"},
+		{"keep query", &urlRules{KeepQuery: true}, "https://tms.example.com/order/12?page=2", "https://tms.example.com/order/{id}?page=2"},
+		{"keep ids", &urlRules{KeepIDs: true}, "https://tms.example.com/order/12?page=2", "https://tms.example.com/order/12"},
+		{"custom rule", custom, "https://tms.example.com/shipment/detail/JKT-0042", "https://tms.example.com/shipment/detail/{code}"},
+		{"custom rules in order", custom, "https://tms.example.com/v1/shipment/detail/JKT-0042?tab=2", "https://tms.example.com/shipment/detail/{code}"},
+		{"custom rule then ids", custom, "https://tms.example.com/v3/order/77", "https://tms.example.com/order/{id}"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := test.rules.normalise(test.url); got != test.want {
+				t.Errorf("got %s, want %s", got, test.want)
+			}
+		})
+	}
+}
+
+func TestLoadURLRules(t *testing.T) {
+	tests := []struct {
+		name    string
+		json    string
+		wantErr bool
+	}{
+		{"rules", `{"rewrites": [{"match": "/detail/[^/]+", "replace": "/detail/{code}"}], "keepQuery": true}`, false},
+		{"empty", `{}`, false},
+		{"bad regexp", `{"rewrites": [{"match": "/detail/(", "replace": "x"}]}`, true},
+		{"unknown field", `{"keepIDs": true, "keepQueries": true}`, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			filename := filepath.Join(t.TempDir(), "rules.json")
+			if err := os.WriteFile(filename, []byte(test.json), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			rules, err := loadURLRules(filename)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("got error %v, want error %v", err, test.wantErr)
+			}
+			if err == nil && len(rules.Rewrites) > 0 && rules.normalise("/detail/abc") != "/detail/{code}" {
+				t.Errorf("got %s, want the rule applied", rules.normalise("/detail/abc"))
+			}
+		})
+	}
+}
@@ -0,0 +1,218 @@
+package main
+
+import (
+	"fmt"
+	"html/template"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/Masterminds/sprig/v3"
+)
+
+// ReportView is the data given to the HTML report template, and to any user templates given with -template
+// The fields of ReportView, and of the types it's made from, are a stable interface for user templates
+type ReportView struct {
+	*ResultData
+	Version     string   // Version of the report converter
+	InputFile   string   // Name of the results file the report was made from
+	InputFormat string   // Description of the input format, e.g. "NDJSON (--out json)"
+	TrendStats  []string // Trend stat columns, from summaryTrendStats or the stats found in the results
+	Builtin     MetricSet
+	Custom      MetricSet // Metrics defined by the test script, e.g. a Counter for gRPC requests
+	Refresh     int       // Seconds between reloads of a live report, 0 when the report is final
+}
+
+// MetricSet holds metrics sorted by name, split by how they're shown
+type MetricSet struct {
+	Trends []Metric // Shown as a table of trend stats
+	Others []Metric // Counters, gauges & rates, shown as a box each
+}
+
+// newReportView makes the report view of some results, splitting built in from custom metrics
+func newReportView(resultData *ResultData, inputFile, inputFormat string) ReportView {
+	view := ReportView{
+		ResultData:  resultData,
+		Version:     version,
+		InputFile:   inputFile,
+		InputFormat: inputFormat,
+		TrendStats:  trendStatColumns(resultData),
+	}
+	for _, name := range sortedMetricNames(resultData.Metrics) {
+		metric := resultData.Metrics[name]
+		set := &view.Custom
+		if isBuiltinMetric(name) {
+			set = &view.Builtin
+		}
+		if metric.Type == "trend" {
+			set.Trends = append(set.Trends, metric)
+		} else {
+			set.Others = append(set.Others, metric)
+		}
+	}
+	return view
+}
+
+// newReportTemplate parses the embedded report template, then any user template file or directory
+func newReportTemplate(userTemplate string, locale *Locale, zone *time.Location) (*template.Template, error) {
+	tmpl, err := template.New("report").Funcs(sprig.FuncMap()).Funcs(reportFuncs(locale, zone)).Parse(templateString)
+	if err != nil {
+		return nil, err
+	}
+	if userTemplate == "" {
+		return tmpl, nil
+	}
+
+	files, err := templateFiles(userTemplate)
+	if err != nil {
+		return nil, err
+	}
+	// Parsing into the same set means a file with a body replaces the whole report, and a file
+	// of only {{ define }} blocks replaces just those partials, e.g. "header" or "checks"
+	for _, file := range files {
+		content, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := tmpl.Parse(string(content)); err != nil {
+			return nil, fmt.Errorf("%s: %w", file, err)
+		}
+	}
+
+	return tmpl, nil
+}
+
+// templateFiles lists the files of a user template, either a single file or all *.tmpl files in a directory
+func templateFiles(path string) ([]string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return []string{path}, nil
+	}
+
+	files, err := filepath.Glob(filepath.Join(path, "*.tmpl"))
+	if err != nil {
+		return nil, err
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no *.tmpl files found in %s", path)
+	}
+	return files, nil
+}
+
+// reportFuncs are the helper functions available to report templates, on top of sprig
+func reportFuncs(locale *Locale, zone *time.Location) template.FuncMap {
+	return template.FuncMap{
+		"groupPath":  groupPathLabel,
+		"msDuration": msDuration,
+		"T":          locale.T,
+		"locale":     func() string { return locale.Code },
+		"num":        func(v interface{}, decimals int) string { return locale.FormatNumber(toFloat(v), decimals) },
+		"datetime":   func(t time.Time) string { return locale.FormatTime(t, zone) },
+		"bytes":      func(v interface{}) string { return formatBytes(locale, toFloat(v)) },
+		"percent":    func(v interface{}) string { return locale.FormatNumber(toFloat(v)*100, 2) + "%" },
+		"passFail":   passFailClass,
+		"fmtStat":    func(metric Metric, stat string) string { return formatStat(locale, metric, stat) },
+		"metricLabel": func(name string) string {
+			base := baseMetricName(name)
+			return locale.T(base) + name[len(base):]
+		},
+		"fmtValue": func(metric Metric, stat string, value float64) string {
+			return formatStatValue(locale, metric, stat, value)
+		},
+		"statLabel":      func(stat string) string { return statLabel(locale, stat) },
+		"timelineCharts": func(timeline *Timeline) []Chart { return timelineCharts(locale, timeline) },
+		"errorCharts":    func(timeline *Timeline) []Chart { return errorTimelineCharts(locale, timeline) },
+		"capacityCharts": func(capacity *Capacity) []Chart { return capacityCharts(locale, capacity) },
+		"driftCharts":    func(drift *Drift) []Chart { return driftCharts(locale, drift) },
+		"metricStats":    metricStats,
+		"metricFailed":   metricFailed,
+		"statFailed":     statFailed,
+	}
+}
+
+// formatStat formats a stat of a metric with the right units, for what the metric type is & what it contains
+func formatStat(locale *Locale, metric Metric, stat string) string {
+	value, ok := metric.Values[stat]
+	if !ok {
+		return "-"
+	}
+	return formatStatValue(locale, metric, stat, value)
+}
+
+// formatStatValue formats any value as a stat of a metric, e.g. the limit of a threshold on that stat
+func formatStatValue(locale *Locale, metric Metric, stat string, value float64) string {
+	switch {
+	case metric.Type == "rate" && stat == "rate":
+		return locale.FormatNumber(value*100, 2) + "%"
+	case metric.Contains == "data" && stat == "rate":
+		return formatBytes(locale, value) + "/s"
+	case metric.Contains == "data":
+		return formatBytes(locale, value)
+	case stat == "rate":
+		return locale.FormatNumber(value, 2) + "/s"
+	case metric.Contains == "time" && stat != "count":
+		return formatMs(locale, value)
+	case value == math.Trunc(value):
+		return locale.FormatNumber(value, 0)
+	}
+	return locale.FormatNumber(value, 2)
+}
+
+// Labels of the trend stat columns, percentiles are labelled by their value
+var trendStatLabels = map[string]string{"avg": "average", "min": "minimum", "med": "median", "max": "maximum"}
+
+// statLabel gets the column heading of a trend stat, e.g. "Average" or "P99.9"
+func statLabel(locale *Locale, stat string) string {
+	if strings.HasPrefix(stat, "p(") {
+		return fmt.Sprintf(locale.T("percentile"), locale.FormatNumber(percentileValue(stat), -1))
+	}
+	if key, ok := trendStatLabels[stat]; ok {
+		return locale.T(key)
+	}
+	return locale.T(stat)
+}
+
+// formatMs formats a time in milliseconds, the same way K6 does, e.g. 250.12 ms, 1.50 s or 2m30s
+func formatMs(locale *Locale, ms float64) string {
+	switch {
+	case math.Abs(ms) < 1000:
+		return locale.FormatNumber(ms, 2) + " ms"
+	case math.Abs(ms) < 60000:
+		return locale.FormatNumber(ms/1000, 2) + " s"
+	}
+	return msDuration(ms)
+}
+
+// formatBytes formats a byte count with decimal units, the same as K6 does, e.g. 1.5 MB
+func formatBytes(locale *Locale, value float64) string {
+	units := []string{"B", "kB", "MB", "GB", "TB"}
+	unit := 0
+	for math.Abs(value) >= 1000 && unit < len(units)-1 {
+		value /= 1000
+		unit++
+	}
+	if unit == 0 {
+		return locale.FormatNumber(value, 0) + " " + units[unit]
+	}
+	return locale.FormatNumber(value, 2) + " " + units[unit]
+}
+
+// passFailClass gives the CSS class for a result, either a bool OK flag or a count of failures
+func passFailClass(v interface{}) string {
+	switch result := v.(type) {
+	case bool:
+		if result {
+			return "passed"
+		}
+		return "failed"
+	}
+	if toFloat(v) > 0 {
+		return "failed"
+	}
+	return "passed"
+}